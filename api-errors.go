@@ -3,6 +3,7 @@ package gonanoweb
 type ApiError struct {
 	StatusCode int    // HTTP status code
 	Message    string // User-facing error message
+	Details    any    // Optional payload sent to the client as "details"
 	err        error  // Original error (not exposed to client)
 }
 
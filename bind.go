@@ -0,0 +1,374 @@
+package gonanoweb
+
+import (
+	"bytes"
+	"encoding"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/url"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type BindOptions struct {
+	DisallowUnknownFields bool   // Reject JSON and form fields that match no struct field
+	MaxBodySize           *int64 // Bodies larger than this are rejected with 413
+}
+
+func DefaultBindOptions() BindOptions {
+	return BindOptions{
+		DisallowUnknownFields: false,
+		MaxBodySize:           nil,
+	}
+}
+
+func (r *Request) bindOptions() *BindOptions {
+	if r.server != nil && r.server.BindOptions != nil {
+		return r.server.BindOptions
+	}
+	defaultOptions := DefaultBindOptions()
+	return &defaultOptions
+}
+
+// Bind fills the struct dst points to: the body is decoded according to its
+// Content-Type (JSON, XML, urlencoded or multipart fields), then fields
+// tagged `param`, `query` and `header` are set from the path parameters,
+// query string and request headers. The result is then checked with
+// Validate; the typed variants below bind without validating.
+func (r *Request) Bind(dst any) error {
+	return r.BindWith(dst, r.bindOptions())
+}
+
+// BindWith is Bind with options overriding the server's BindOptions.
+func (r *Request) BindWith(dst any, options *BindOptions) error {
+	if err := checkBindTarget(dst); err != nil {
+		return err
+	}
+
+	if (r.Body != nil && len(*r.Body) > 0) || r.FormData != nil {
+		if err := r.bindBody(dst, options); err != nil {
+			return err
+		}
+	}
+
+	if err := r.BindParams(dst); err != nil {
+		return err
+	}
+	if err := r.BindQuery(dst); err != nil {
+		return err
+	}
+	if err := r.BindHeaders(dst); err != nil {
+		return err
+	}
+	return Validate(dst)
+}
+
+func (r *Request) bindBody(dst any, options *BindOptions) error {
+	mediaType, _, _ := mime.ParseMediaType(r.Headers["content-type"])
+	switch {
+	case mediaType == "application/json" || strings.HasSuffix(mediaType, "+json"):
+		return r.bindJSON(dst, options)
+	case mediaType == "application/xml" || mediaType == "text/xml" || strings.HasSuffix(mediaType, "+xml"):
+		return r.bindXML(dst, options)
+	case mediaType == "application/x-www-form-urlencoded" || mediaType == "multipart/form-data":
+		return r.bindForm(dst, options)
+	}
+	return ApiError{StatusCode: 415, Message: "Unsupported Content-Type."}.WithError(fmt.Errorf("cannot bind content type %q", mediaType))
+}
+
+// BindJSON decodes the body as JSON regardless of its Content-Type.
+func (r *Request) BindJSON(dst any) error {
+	if err := checkBindTarget(dst); err != nil {
+		return err
+	}
+	return r.bindJSON(dst, r.bindOptions())
+}
+
+func (r *Request) bindJSON(dst any, options *BindOptions) error {
+	body, err := r.bindableBody(options)
+	if err != nil {
+		return err
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(body))
+	if options.DisallowUnknownFields {
+		decoder.DisallowUnknownFields()
+	}
+
+	if err := decoder.Decode(dst); err != nil {
+		var syntaxErr *json.SyntaxError
+		var typeErr *json.UnmarshalTypeError
+		switch {
+		case errors.As(err, &typeErr) && typeErr.Field != "":
+			return ApiError{StatusCode: 400, Message: fmt.Sprintf("Invalid value for field %q.", typeErr.Field)}.WithError(err)
+		case strings.HasPrefix(err.Error(), "json: unknown field "):
+			field := strings.TrimPrefix(err.Error(), "json: unknown field ")
+			return ApiError{StatusCode: 400, Message: "Unknown field " + field + "."}.WithError(err)
+		case errors.As(err, &syntaxErr), errors.Is(err, io.ErrUnexpectedEOF), errors.Is(err, io.EOF):
+			return ApiError{StatusCode: 400, Message: "Malformed JSON body."}.WithError(err)
+		}
+		return ApiError{StatusCode: 400, Message: "Invalid JSON body."}.WithError(err)
+	}
+
+	if decoder.More() {
+		return ApiError{StatusCode: 400, Message: "Malformed JSON body."}.WithError(errors.New("unexpected data after JSON value"))
+	}
+	return nil
+}
+
+// BindXML decodes the body as XML regardless of its Content-Type.
+func (r *Request) BindXML(dst any) error {
+	if err := checkBindTarget(dst); err != nil {
+		return err
+	}
+	return r.bindXML(dst, r.bindOptions())
+}
+
+func (r *Request) bindXML(dst any, options *BindOptions) error {
+	body, err := r.bindableBody(options)
+	if err != nil {
+		return err
+	}
+
+	if err := xml.Unmarshal(body, dst); err != nil {
+		return ApiError{StatusCode: 400, Message: "Malformed XML body."}.WithError(err)
+	}
+	return nil
+}
+
+// BindForm sets fields tagged `form` from an urlencoded or multipart body.
+func (r *Request) BindForm(dst any) error {
+	if err := checkBindTarget(dst); err != nil {
+		return err
+	}
+	return r.bindForm(dst, r.bindOptions())
+}
+
+func (r *Request) bindForm(dst any, options *BindOptions) error {
+	mediaType, _, _ := mime.ParseMediaType(r.Headers["content-type"])
+	if mediaType != "application/x-www-form-urlencoded" && mediaType != "multipart/form-data" {
+		return ApiError{StatusCode: 415, Message: "Unsupported Content-Type."}.WithError(fmt.Errorf("cannot bind form from content type %q", mediaType))
+	}
+	body, err := r.bindableBody(options)
+	if err != nil {
+		return err
+	}
+
+	// A body that was not parsed into FormData is either malformed or was
+	// never meant to be, e.g. multipart without FormDataMiddleware.
+	var values map[string][]string
+	switch {
+	case r.FormData != nil:
+		values = r.FormData.Fields
+	case r.MultipartReader != nil:
+		return errors.New("multipart body is streamed, read it from GetMultipartReader")
+	case len(body) > 0:
+		return formDataError(r)
+	}
+	return bindValues(reflect.ValueOf(dst).Elem(), "form", values, options.DisallowUnknownFields)
+}
+
+// BindParams sets fields tagged `param` from the path parameters.
+func (r *Request) BindParams(dst any) error {
+	if err := checkBindTarget(dst); err != nil {
+		return err
+	}
+
+	values := make(map[string][]string, len(r.Params))
+	for key, value := range r.Params {
+		values[key] = []string{value}
+	}
+	return bindValues(reflect.ValueOf(dst).Elem(), "param", values, false)
+}
+
+// BindQuery sets fields tagged `query` from the query string. Keys and
+// values are URL-decoded, unlike r.QueryParams.
+func (r *Request) BindQuery(dst any) error {
+	if err := checkBindTarget(dst); err != nil {
+		return err
+	}
+
+	values := make(map[string][]string, len(r.QueryParams))
+	for rawKey, rawValues := range r.QueryParams {
+		key, err := url.QueryUnescape(rawKey)
+		if err != nil {
+			return ApiError{StatusCode: 400, Message: "Malformed query string."}.WithError(err)
+		}
+		for _, rawValue := range rawValues {
+			value, err := url.QueryUnescape(rawValue)
+			if err != nil {
+				return ApiError{StatusCode: 400, Message: "Malformed query string."}.WithError(err)
+			}
+			values[key] = append(values[key], value)
+		}
+	}
+	return bindValues(reflect.ValueOf(dst).Elem(), "query", values, false)
+}
+
+// BindHeaders sets fields tagged `header` from the request headers. Header
+// names are matched case-insensitively.
+func (r *Request) BindHeaders(dst any) error {
+	if err := checkBindTarget(dst); err != nil {
+		return err
+	}
+
+	values := make(map[string][]string, len(r.Headers))
+	for key, value := range r.Headers {
+		values[key] = []string{value}
+	}
+	return bindValues(reflect.ValueOf(dst).Elem(), "header", values, false)
+}
+
+func (r *Request) bindableBody(options *BindOptions) ([]byte, error) {
+	if r.Body == nil {
+		return nil, nil
+	}
+	if options.MaxBodySize != nil && int64(len(*r.Body)) > *options.MaxBodySize {
+		return nil, ApiError{StatusCode: 413, Message: "Request body too large."}.WithError(fmt.Errorf("body of %d bytes exceeds bind limit %d", len(*r.Body), *options.MaxBodySize))
+	}
+	return *r.Body, nil
+}
+
+func checkBindTarget(dst any) error {
+	v := reflect.ValueOf(dst)
+	if v.Kind() != reflect.Pointer || v.IsNil() || v.Elem().Kind() != reflect.Struct {
+		return fmt.Errorf("bind target must be a non-nil pointer to a struct, got %T", dst)
+	}
+	return nil
+}
+
+// bindValues sets the fields of the struct v tagged with tag from values.
+// Embedded structs are walked as if their fields were declared in v.
+func bindValues(v reflect.Value, tag string, values map[string][]string, disallowUnknown bool) error {
+	known := make(map[string]bool)
+	if err := bindStruct(v, tag, values, known); err != nil {
+		return err
+	}
+
+	if disallowUnknown {
+		for key := range values {
+			if !known[key] {
+				return ApiError{StatusCode: 400, Message: fmt.Sprintf("Unknown field %q.", key)}.WithError(fmt.Errorf("no field tagged %s:%q", tag, key))
+			}
+		}
+	}
+	return nil
+}
+
+func bindStruct(v reflect.Value, tag string, values map[string][]string, known map[string]bool) error {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		name, _, _ := strings.Cut(field.Tag.Get(tag), ",")
+
+		if name == "" {
+			if field.Anonymous && field.Type.Kind() == reflect.Struct {
+				if err := bindStruct(v.Field(i), tag, values, known); err != nil {
+					return err
+				}
+			}
+			continue
+		}
+		if name == "-" || !field.IsExported() {
+			continue
+		}
+
+		if tag == "header" {
+			name = strings.ToLower(name)
+		}
+		known[name] = true
+
+		raw, ok := values[name]
+		if !ok || len(raw) == 0 {
+			continue
+		}
+		if err := setField(v.Field(i), raw); err != nil {
+			return ApiError{StatusCode: 400, Message: fmt.Sprintf("Invalid value for field %q.", name)}.WithError(err)
+		}
+	}
+	return nil
+}
+
+var (
+	textUnmarshalerType = reflect.TypeOf((*encoding.TextUnmarshaler)(nil)).Elem()
+	durationType        = reflect.TypeOf(time.Duration(0))
+)
+
+// setField converts raw into the type of v. Slices take every value, other
+// types the first one.
+func setField(v reflect.Value, raw []string) error {
+	if v.Kind() == reflect.Pointer {
+		if v.IsNil() {
+			v.Set(reflect.New(v.Type().Elem()))
+		}
+		return setField(v.Elem(), raw)
+	}
+
+	if reflect.PointerTo(v.Type()).Implements(textUnmarshalerType) {
+		return v.Addr().Interface().(encoding.TextUnmarshaler).UnmarshalText([]byte(raw[0]))
+	}
+
+	if v.Kind() == reflect.Slice && v.Type().Elem().Kind() != reflect.Uint8 {
+		slice := reflect.MakeSlice(v.Type(), len(raw), len(raw))
+		for i, value := range raw {
+			if err := setField(slice.Index(i), []string{value}); err != nil {
+				return err
+			}
+		}
+		v.Set(slice)
+		return nil
+	}
+
+	return setScalar(v, raw[0])
+}
+
+func setScalar(v reflect.Value, value string) error {
+	if v.Type() == durationType {
+		d, err := time.ParseDuration(value)
+		if err != nil {
+			return err
+		}
+		v.SetInt(int64(d))
+		return nil
+	}
+
+	switch v.Kind() {
+	case reflect.String:
+		v.SetString(value)
+	case reflect.Slice:
+		v.SetBytes([]byte(value))
+	case reflect.Bool:
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return err
+		}
+		v.SetBool(b)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n, err := strconv.ParseInt(value, 10, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetInt(n)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		n, err := strconv.ParseUint(value, 10, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetUint(n)
+	case reflect.Float32, reflect.Float64:
+		f, err := strconv.ParseFloat(value, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetFloat(f)
+	default:
+		return fmt.Errorf("unsupported field type %s", v.Type())
+	}
+	return nil
+}
@@ -0,0 +1,235 @@
+package gonanoweb
+
+import (
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// EncoderFunc wraps w in a writer producing the given content coding.
+type EncoderFunc func(w io.Writer, level int) (io.WriteCloser, error)
+
+// CompressionOptions configures CompressionMiddleware. Options without
+// registered encoders use gzip and deflate, as DefaultCompressionOptions does.
+type CompressionOptions struct {
+	Level                int      // Compression level passed to the encoders, 0 selects the default
+	MinLength            int      // Bodies smaller than this are sent uncompressed
+	ExcludedContentTypes []string // Content type prefixes that are already compressed
+	encoders             []namedEncoder
+}
+
+type namedEncoder struct {
+	name   string
+	encode EncoderFunc
+}
+
+func DefaultCompressionOptions() CompressionOptions {
+	options := CompressionOptions{
+		Level:     gzip.DefaultCompression,
+		MinLength: 1024,
+		ExcludedContentTypes: []string{
+			"image/png", "image/jpeg", "image/gif", "image/webp", "image/avif",
+			"video/", "audio/", "font/woff",
+			"application/zip", "application/gzip", "application/x-gzip",
+			"application/zstd", "application/x-7z-compressed", "application/x-rar-compressed",
+			"multipart/byteranges",
+		},
+	}
+	options.RegisterEncoder("gzip", func(w io.Writer, level int) (io.WriteCloser, error) {
+		return gzip.NewWriterLevel(w, level)
+	})
+	options.RegisterEncoder("deflate", func(w io.Writer, level int) (io.WriteCloser, error) {
+		return zlib.NewWriterLevel(w, level)
+	})
+	return options
+}
+
+// RegisterEncoder adds (or replaces) a content coding. When the client
+// accepts several codings with the same q-value, earlier registrations win.
+func (o *CompressionOptions) RegisterEncoder(name string, encode EncoderFunc) {
+	name = strings.ToLower(name)
+	for i, e := range o.encoders {
+		if e.name == name {
+			o.encoders[i].encode = encode
+			return
+		}
+	}
+	o.encoders = append(o.encoders, namedEncoder{name: name, encode: encode})
+}
+
+type compression struct {
+	encoder namedEncoder
+	options *CompressionOptions
+}
+
+// CompressionMiddleware negotiates a content coding from Accept-Encoding and
+// compresses the response when it is sent: buffered bodies, streamed bodies
+// and event streams alike.
+func CompressionMiddleware(options *CompressionOptions) Middleware {
+	if options == nil {
+		defaultOptions := DefaultCompressionOptions()
+		options = &defaultOptions
+	}
+	if len(options.encoders) == 0 || options.Level == 0 {
+		defaultOptions := DefaultCompressionOptions()
+		withDefaults := *options
+		if len(withDefaults.encoders) == 0 {
+			withDefaults.encoders = defaultOptions.encoders
+		}
+		if withDefaults.Level == 0 {
+			withDefaults.Level = defaultOptions.Level
+		}
+		options = &withDefaults
+	}
+
+	return Middleware{
+		Handler: func(res *Response, req *Request) error {
+			res.Headers.Add("Vary", "Accept-Encoding")
+			if encoder, ok := negotiateEncoding(req.Headers["accept-encoding"], options.encoders); ok {
+				res.compression = &compression{encoder: encoder, options: options}
+			}
+			return nil
+		},
+	}
+}
+
+// negotiateEncoding picks the encoder with the highest q-value in header.
+func negotiateEncoding(header string, encoders []namedEncoder) (namedEncoder, bool) {
+	var best namedEncoder
+	bestQ := 0.0
+	for _, encoder := range encoders {
+		q := encodingQuality(header, encoder.name)
+		if q > bestQ {
+			best, bestQ = encoder, q
+		}
+	}
+	return best, bestQ > 0
+}
+
+// encodingQuality returns the q-value the Accept-Encoding header assigns to
+// coding, taking "*" into account, or 0 if it is not acceptable.
+func encodingQuality(header string, coding string) float64 {
+	wildcard := -1.0
+	for _, part := range strings.Split(header, ",") {
+		name, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name != coding && name != "*" {
+			continue
+		}
+
+		q := 1.0
+		for _, param := range strings.Split(params, ";") {
+			if v, ok := strings.CutPrefix(strings.TrimSpace(param), "q="); ok {
+				if parsed, err := strconv.ParseFloat(v, 64); err == nil {
+					q = parsed
+				}
+			}
+		}
+
+		if name == coding {
+			return q
+		}
+		wildcard = q
+	}
+	if wildcard > 0 {
+		return wildcard
+	}
+	return 0
+}
+
+// compressible reports whether the response should be compressed, given the
+// length of its body (-1 if unknown).
+func (c *compression) compressible(res *Response, length int64) bool {
+	if res.Status < 200 || res.Status == 204 || res.Status == 206 || res.Status == 304 {
+		return false
+	}
+	if res.Headers.Get("Content-Encoding") != "" || res.Headers.Get("Content-Range") != "" {
+		return false
+	}
+	if length >= 0 && length < int64(c.options.MinLength) {
+		return false
+	}
+
+	contentType := strings.ToLower(res.Headers.Get("Content-Type"))
+	for _, excluded := range c.options.ExcludedContentTypes {
+		if strings.HasPrefix(contentType, excluded) {
+			return false
+		}
+	}
+	return true
+}
+
+// applyCompression compresses a buffered Body in place. For a streamed body
+// it returns the encoder Done has to copy the body through; the response is
+// then delimited by closing the connection.
+func (r *Response) applyCompression() EncoderFunc {
+	c := r.compression
+	if c == nil {
+		return nil
+	}
+
+	if r.bodyReader != nil {
+		if !c.compressible(r, r.bodyLength) {
+			return nil
+		}
+		r.setContentEncoding(c.encoder.name)
+		return c.encoder.encode
+	}
+
+	if r.Body == nil || !c.compressible(r, int64(len(r.Body))) {
+		return nil
+	}
+
+	var buf bytes.Buffer
+	w, err := c.encoder.encode(&buf, c.options.Level)
+	if err != nil {
+		return nil
+	}
+	if _, err := w.Write(r.Body); err != nil {
+		return nil
+	}
+	if err := w.Close(); err != nil {
+		return nil
+	}
+
+	r.Body = buf.Bytes()
+	r.setContentEncoding(c.encoder.name)
+	return nil
+}
+
+// setContentEncoding marks the body as encoded. A strong entity tag no
+// longer identifies the bytes sent, so it is weakened.
+func (r *Response) setContentEncoding(name string) {
+	r.Headers.Set("Content-Encoding", name)
+	if etag := r.Headers.Get("ETag"); etag != "" && !strings.HasPrefix(etag, "W/") {
+		r.Headers.Set("ETag", "W/"+etag)
+	}
+}
+
+type flusher interface {
+	Flush() error
+}
+
+// eventStreamWriter returns the writer event stream messages go through and
+// a function flushing each message to the client.
+func (r *Response) eventStreamWriter() (io.Writer, func() error, func() error) {
+	c := r.compression
+	if c == nil {
+		return r.conn, func() error { return nil }, func() error { return nil }
+	}
+
+	w, err := c.encoder.encode(r.conn, c.options.Level)
+	if err != nil {
+		return r.conn, func() error { return nil }, func() error { return nil }
+	}
+	r.Headers.Set("Content-Encoding", c.encoder.name)
+
+	flush := func() error { return nil }
+	if f, ok := w.(flusher); ok {
+		flush = f.Flush
+	}
+	return w, flush, w.Close
+}
@@ -0,0 +1,298 @@
+package gonanoweb
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type byteRange struct {
+	start  int64
+	length int64
+}
+
+func (r byteRange) contentRange(size int64) string {
+	return "bytes " + strconv.FormatInt(r.start, 10) + "-" + strconv.FormatInt(r.start+r.length-1, 10) + "/" + strconv.FormatInt(size, 10)
+}
+
+var errUnsatisfiableRange = errors.New("requested range not satisfiable")
+
+// serveContent answers a GET or HEAD request from content, handling
+// If-None-Match / If-Modified-Since with 304 and Range / If-Range with 206.
+// The content is closed by the response once sent if it is an io.Closer.
+func serveContent(res *Response, req *Request, content io.ReadSeeker, size int64, etag string, modTime time.Time) {
+	if etag != "" {
+		res.Headers.Set("ETag", etag)
+	}
+	if !modTime.IsZero() {
+		res.Headers.Set("Last-Modified", modTime.UTC().Format(http.TimeFormat))
+	}
+
+	if notModified(req, etag, modTime) {
+		if closer, ok := content.(io.Closer); ok {
+			closer.Close()
+		}
+		res.discardBodyReader()
+		res.Status = 304
+		res.Body = nil
+		return
+	}
+
+	res.Headers.Set("Accept-Ranges", "bytes")
+
+	status := 200
+	start, length := int64(0), size
+	if header := req.Headers["range"]; header != "" && (req.Method == "GET" || req.Method == "HEAD") && ifRangeMatches(req, etag, modTime) {
+		ranges, err := parseRange(header, size)
+		if err == errUnsatisfiableRange {
+			if closer, ok := content.(io.Closer); ok {
+				closer.Close()
+			}
+			// The error body is not the requested representation, so none
+			// of its headers may describe it.
+			for _, key := range []string{"Content-Type", "ETag", "Last-Modified", "Accept-Ranges"} {
+				res.Headers.Del(key)
+			}
+			res.Headers.Set("Content-Range", "bytes */"+strconv.FormatInt(size, 10))
+			res.ApiError(416, "Requested range not satisfiable.")
+			return
+		}
+		if len(ranges) == 1 {
+			status = 206
+			start, length = ranges[0].start, ranges[0].length
+			res.Headers.Set("Content-Range", ranges[0].contentRange(size))
+		} else if len(ranges) > 1 && rangesWorthServing(ranges, size) {
+			contentType := res.Headers.Get("Content-Type")
+			if contentType == "" {
+				contentType = "application/octet-stream"
+			}
+			body := newMultipartRanges(content, ranges, size, contentType)
+			res.Headers.Set("Content-Type", "multipart/byteranges; boundary="+body.boundary)
+			res.Status = 206
+			res.setBodyReader(body, body.length())
+			return
+		}
+	}
+
+	if _, err := content.Seek(start, io.SeekStart); err != nil {
+		if closer, ok := content.(io.Closer); ok {
+			closer.Close()
+		}
+		res.ApiError(500, "Failed to read content.")
+		return
+	}
+
+	res.Status = status
+	res.setBodyReader(content, length)
+}
+
+// notModified evaluates If-None-Match and, in its absence, If-Modified-Since.
+func notModified(req *Request, etag string, modTime time.Time) bool {
+	if req.Method != "GET" && req.Method != "HEAD" {
+		return false
+	}
+
+	if inm := req.Headers["if-none-match"]; inm != "" {
+		return etag != "" && etagListMatches(inm, etag, false)
+	}
+
+	if ims := req.Headers["if-modified-since"]; ims != "" && !modTime.IsZero() {
+		t, err := http.ParseTime(ims)
+		return err == nil && !modTime.Truncate(time.Second).After(t)
+	}
+	return false
+}
+
+// ifRangeMatches reports whether a Range header should be honored: either
+// there is no If-Range, or it still matches the current representation.
+func ifRangeMatches(req *Request, etag string, modTime time.Time) bool {
+	ifRange := strings.TrimSpace(req.Headers["if-range"])
+	if ifRange == "" {
+		return true
+	}
+
+	if strings.HasPrefix(ifRange, "\"") || strings.HasPrefix(ifRange, "W/") {
+		return etag != "" && etagListMatches(ifRange, etag, true)
+	}
+
+	t, err := http.ParseTime(ifRange)
+	return err == nil && !modTime.IsZero() && modTime.Truncate(time.Second).Equal(t)
+}
+
+// etagListMatches compares etag against a comma separated list of entity
+// tags, using strong comparison if strong is set and weak otherwise.
+func etagListMatches(list string, etag string, strong bool) bool {
+	for _, candidate := range strings.Split(list, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" && !strong {
+			return true
+		}
+		if strong {
+			if candidate == etag && !strings.HasPrefix(etag, "W/") {
+				return true
+			}
+			continue
+		}
+		if strings.TrimPrefix(candidate, "W/") == strings.TrimPrefix(etag, "W/") {
+			return true
+		}
+	}
+	return false
+}
+
+// parseRange parses a "bytes=" Range header. Syntactically invalid headers
+// are ignored by returning no ranges; errUnsatisfiableRange is returned when
+// none of the ranges overlaps the content.
+func parseRange(header string, size int64) ([]byteRange, error) {
+	spec, ok := strings.CutPrefix(strings.TrimSpace(header), "bytes=")
+	if !ok || strings.TrimSpace(spec) == "" {
+		return nil, nil
+	}
+
+	var ranges []byteRange
+	for _, part := range strings.Split(spec, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		first, last, ok := strings.Cut(part, "-")
+		if !ok {
+			return nil, nil
+		}
+		first, last = strings.TrimSpace(first), strings.TrimSpace(last)
+
+		var r byteRange
+		if first == "" {
+			// Suffix range: the last n bytes.
+			n, err := strconv.ParseInt(last, 10, 64)
+			if err != nil || n < 0 {
+				return nil, nil
+			}
+			if n == 0 || size == 0 {
+				continue
+			}
+			if n > size {
+				n = size
+			}
+			r = byteRange{start: size - n, length: n}
+		} else {
+			start, err := strconv.ParseInt(first, 10, 64)
+			if err != nil || start < 0 {
+				return nil, nil
+			}
+			end := size - 1
+			if last != "" {
+				end, err = strconv.ParseInt(last, 10, 64)
+				if err != nil || end < start {
+					return nil, nil
+				}
+				if end >= size {
+					end = size - 1
+				}
+			}
+			if start >= size {
+				continue
+			}
+			r = byteRange{start: start, length: end - start + 1}
+		}
+		ranges = append(ranges, r)
+	}
+
+	if len(ranges) == 0 {
+		return nil, errUnsatisfiableRange
+	}
+	return ranges, nil
+}
+
+// rangesWorthServing guards against requests for many tiny or overlapping
+// ranges; such requests get the whole content instead.
+func rangesWorthServing(ranges []byteRange, size int64) bool {
+	if len(ranges) > 100 {
+		return false
+	}
+	var total int64
+	for _, r := range ranges {
+		total += r.length
+	}
+	return total <= size
+}
+
+// multipartRanges streams a multipart/byteranges body, seeking the content to
+// each range as it is reached.
+type multipartRanges struct {
+	content  io.ReadSeeker
+	ranges   []byteRange
+	headers  []string
+	boundary string
+	current  int
+	section  io.Reader
+}
+
+func newMultipartRanges(content io.ReadSeeker, ranges []byteRange, size int64, contentType string) *multipartRanges {
+	m := &multipartRanges{
+		content:  content,
+		ranges:   ranges,
+		boundary: randomBoundary(),
+		current:  -1,
+	}
+	for _, r := range ranges {
+		m.headers = append(m.headers, "\r\n--"+m.boundary+"\r\nContent-Type: "+contentType+"\r\nContent-Range: "+r.contentRange(size)+"\r\n\r\n")
+	}
+	return m
+}
+
+func (m *multipartRanges) length() int64 {
+	total := int64(len("\r\n--" + m.boundary + "--\r\n"))
+	for i, r := range m.ranges {
+		total += int64(len(m.headers[i])) + r.length
+	}
+	return total
+}
+
+func (m *multipartRanges) Read(p []byte) (int, error) {
+	for {
+		if m.section != nil {
+			n, err := m.section.Read(p)
+			if err == io.EOF {
+				m.section = nil
+				err = nil
+			}
+			if n > 0 || err != nil {
+				return n, err
+			}
+			continue
+		}
+
+		m.current++
+		switch {
+		case m.current < len(m.ranges):
+			r := m.ranges[m.current]
+			if _, err := m.content.Seek(r.start, io.SeekStart); err != nil {
+				return 0, err
+			}
+			m.section = io.MultiReader(strings.NewReader(m.headers[m.current]), io.LimitReader(m.content, r.length))
+		case m.current == len(m.ranges):
+			m.section = strings.NewReader("\r\n--" + m.boundary + "--\r\n")
+		default:
+			return 0, io.EOF
+		}
+	}
+}
+
+func (m *multipartRanges) Close() error {
+	if closer, ok := m.content.(io.Closer); ok {
+		return closer.Close()
+	}
+	return nil
+}
+
+func randomBoundary() string {
+	var buf [16]byte
+	rand.Read(buf[:])
+	return hex.EncodeToString(buf[:])
+}
@@ -0,0 +1,169 @@
+package gonanoweb
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"mime/multipart"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseRange(t *testing.T) {
+	tests := []struct {
+		header  string
+		size    int64
+		want    []byteRange
+		wantErr error
+	}{
+		{header: "bytes=0-499", size: 1000, want: []byteRange{{0, 500}}},
+		{header: "bytes=500-", size: 1000, want: []byteRange{{500, 500}}},
+		{header: "bytes=999-", size: 1000, want: []byteRange{{999, 1}}},
+		{header: "bytes=0-99999", size: 1000, want: []byteRange{{0, 1000}}},
+		{header: "bytes=-200", size: 1000, want: []byteRange{{800, 200}}},
+		{header: "bytes=-2000", size: 1000, want: []byteRange{{0, 1000}}},
+		{header: "bytes=-999999999999999999", size: 1000, want: []byteRange{{0, 1000}}},
+		{header: "bytes= 0-1 , 5-6 ", size: 1000, want: []byteRange{{0, 2}, {5, 2}}},
+		{header: "bytes=0-499,200-699", size: 1000, want: []byteRange{{0, 500}, {200, 500}}},
+		{header: "bytes=0-1,1000-2000", size: 1000, want: []byteRange{{0, 2}}},
+
+		{header: "bytes=-0", size: 1000, wantErr: errUnsatisfiableRange},
+		{header: "bytes=1000-", size: 1000, wantErr: errUnsatisfiableRange},
+		{header: "bytes=1000-1001,2000-", size: 1000, wantErr: errUnsatisfiableRange},
+		{header: "bytes=-5", size: 0, wantErr: errUnsatisfiableRange},
+		{header: "bytes=0-", size: 0, wantErr: errUnsatisfiableRange},
+
+		// Syntactically invalid headers are ignored.
+		{header: "", size: 1000},
+		{header: "bytes=", size: 1000},
+		{header: "items=0-1", size: 1000},
+		{header: "bytes=abc", size: 1000},
+		{header: "bytes=5", size: 1000},
+		{header: "bytes=500-400", size: 1000},
+		{header: "bytes=--5", size: 1000},
+		{header: "bytes=-1-2", size: 1000},
+		{header: "bytes=0-1,x-y", size: 1000},
+		{header: "bytes=99999999999999999999-", size: 1000},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.header, func(t *testing.T) {
+			got, err := parseRange(tt.header, tt.size)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("got error %v, want %v", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got ranges %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRangesWorthServing(t *testing.T) {
+	many := make([]byteRange, 101)
+	for i := range many {
+		many[i] = byteRange{start: int64(i), length: 1}
+	}
+
+	tests := []struct {
+		name   string
+		ranges []byteRange
+		want   bool
+	}{
+		{name: "single", ranges: []byteRange{{0, 500}}, want: true},
+		{name: "disjoint", ranges: []byteRange{{0, 100}, {500, 100}}, want: true},
+		{name: "overlap within size", ranges: []byteRange{{0, 500}, {200, 500}}, want: true},
+		{name: "overlap beyond size", ranges: []byteRange{{0, 600}, {200, 800}}, want: false},
+		{name: "same range repeated", ranges: []byteRange{{0, 1000}, {0, 1000}}, want: false},
+		{name: "too many ranges", ranges: many, want: false},
+		{name: "exactly 100 ranges", ranges: many[:100], want: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := rangesWorthServing(tt.ranges, 1000); got != tt.want {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMultipartRanges(t *testing.T) {
+	content := "0123456789abcdefghij"
+	tests := []struct {
+		name   string
+		ranges []byteRange
+	}{
+		{name: "disjoint", ranges: []byteRange{{0, 3}, {10, 5}}},
+		{name: "overlapping", ranges: []byteRange{{2, 6}, {4, 6}}},
+		{name: "out of order", ranges: []byteRange{{15, 5}, {0, 1}}},
+		{name: "whole content", ranges: []byteRange{{0, 20}, {19, 1}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := newMultipartRanges(strings.NewReader(content), tt.ranges, int64(len(content)), "text/plain")
+			body, err := io.ReadAll(m)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if int64(len(body)) != m.length() {
+				t.Errorf("body is %d bytes, length() reported %d", len(body), m.length())
+			}
+
+			reader := multipart.NewReader(bytes.NewReader(body), m.boundary)
+			for i, r := range tt.ranges {
+				part, err := reader.NextPart()
+				if err != nil {
+					t.Fatalf("part %d: %v", i, err)
+				}
+				if got, want := part.Header.Get("Content-Range"), r.contentRange(int64(len(content))); got != want {
+					t.Errorf("part %d: Content-Range %q, want %q", i, got, want)
+				}
+				if got := part.Header.Get("Content-Type"); got != "text/plain" {
+					t.Errorf("part %d: Content-Type %q", i, got)
+				}
+				data, _ := io.ReadAll(part)
+				if want := content[r.start : r.start+r.length]; string(data) != want {
+					t.Errorf("part %d: got %q, want %q", i, data, want)
+				}
+			}
+			if _, err := reader.NextPart(); err != io.EOF {
+				t.Errorf("expected end of body, got %v", err)
+			}
+		})
+	}
+}
+
+func TestUnsatisfiableRangeHeaders(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "hello.txt")
+	if err := os.WriteFile(path, []byte("hello world"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	s := NewServer(":0", nil)
+	s.Get("/file", func(res *Response, req *Request) error {
+		return res.File(path)
+	})
+
+	res, body := serveRaw(t, s, "GET /file HTTP/1.1\r\nHost: example.com\r\nRange: bytes=5000-\r\n\r\n")
+	if res.StatusCode != 416 {
+		t.Fatalf("got status %d, want 416", res.StatusCode)
+	}
+	if got := res.Header.Values("Content-Type"); len(got) != 1 || got[0] != "application/json" {
+		t.Errorf("got Content-Type %q, want only application/json", got)
+	}
+	if got := res.Header.Get("Content-Range"); got != "bytes */11" {
+		t.Errorf("got Content-Range %q", got)
+	}
+	for _, key := range []string{"ETag", "Last-Modified", "Accept-Ranges"} {
+		if got := res.Header.Get(key); got != "" {
+			t.Errorf("got %s %q on a 416", key, got)
+		}
+	}
+	if !strings.Contains(body, "Requested range not satisfiable.") {
+		t.Errorf("got body %q", body)
+	}
+}
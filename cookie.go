@@ -0,0 +1,193 @@
+package gonanoweb
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var ErrNoCookie = errors.New("named cookie not present")
+
+// Cookie is a cookie sent by the client or set with Response.SetCookie. The
+// attributes come from the embedded CookieOptions; MaxAge > 0 sets Max-Age
+// in seconds and MaxAge < 0 expires the cookie immediately.
+type Cookie struct {
+	Name    string
+	Value   string
+	Expires time.Time
+	CookieOptions
+}
+
+func NewCookie(name string, value string, options *CookieOptions) *Cookie {
+	cookie := &Cookie{Name: name, Value: value}
+	if options != nil {
+		cookie.CookieOptions = *options
+	}
+	return cookie
+}
+
+// Cookies parses the Cookie header. Malformed pairs are skipped.
+func (r *Request) Cookies() []*Cookie {
+	var cookies []*Cookie
+	for _, pair := range strings.Split(r.Headers["cookie"], ";") {
+		name, value, ok := strings.Cut(strings.TrimSpace(pair), "=")
+		if !ok || !validCookieName(name) {
+			continue
+		}
+		value, ok = parseCookieValue(value)
+		if !ok {
+			continue
+		}
+		cookies = append(cookies, &Cookie{Name: name, Value: value})
+	}
+	return cookies
+}
+
+// Cookie returns the first cookie with the given name, or ErrNoCookie.
+func (r *Request) Cookie(name string) (*Cookie, error) {
+	for _, cookie := range r.Cookies() {
+		if cookie.Name == name {
+			return cookie, nil
+		}
+	}
+	return nil, ErrNoCookie
+}
+
+// SetCookie adds a Set-Cookie header after validating the cookie.
+func (r *Response) SetCookie(cookie *Cookie) error {
+	value, err := cookie.String()
+	if err != nil {
+		return err
+	}
+	r.Headers.Add("Set-Cookie", value)
+	return nil
+}
+
+// ClearCookie tells the client to delete a cookie. Path and Domain must
+// match the ones the cookie was set with.
+func (r *Response) ClearCookie(name string, options *CookieOptions) error {
+	cookie := NewCookie(name, "", options)
+	cookie.MaxAge = -1
+	cookie.Expires = time.Unix(0, 0)
+	return r.SetCookie(cookie)
+}
+
+// String serializes the cookie for a Set-Cookie header. Values containing
+// spaces or commas are quoted.
+func (c *Cookie) String() (string, error) {
+	if !validCookieName(c.Name) {
+		return "", fmt.Errorf("invalid cookie name %q", c.Name)
+	}
+	for i := 0; i < len(c.Value); i++ {
+		if !validCookieValueByte(c.Value[i]) {
+			return "", fmt.Errorf("invalid byte %q in value of cookie %q", c.Value[i], c.Name)
+		}
+	}
+	if strings.ContainsAny(c.Path, ";\x7f") || strings.IndexFunc(c.Path, func(r rune) bool { return r < 0x20 }) != -1 {
+		return "", fmt.Errorf("invalid path %q for cookie %q", c.Path, c.Name)
+	}
+	if c.Domain != "" && !validCookieDomain(c.Domain) {
+		return "", fmt.Errorf("invalid domain %q for cookie %q", c.Domain, c.Name)
+	}
+	if c.SameSite == http.SameSiteNoneMode && !c.Secure {
+		return "", fmt.Errorf("cookie %q has SameSite=None but is not Secure", c.Name)
+	}
+	if c.Partitioned && !c.Secure {
+		return "", fmt.Errorf("cookie %q is Partitioned but not Secure", c.Name)
+	}
+
+	var b strings.Builder
+	b.WriteString(c.Name)
+	b.WriteByte('=')
+	if strings.ContainsAny(c.Value, " ,") {
+		b.WriteString("\"" + c.Value + "\"")
+	} else {
+		b.WriteString(c.Value)
+	}
+
+	if c.Path != "" {
+		b.WriteString("; Path=")
+		b.WriteString(c.Path)
+	}
+	if c.Domain != "" {
+		b.WriteString("; Domain=")
+		b.WriteString(strings.TrimPrefix(c.Domain, "."))
+	}
+	if !c.Expires.IsZero() && c.Expires.Year() >= 1601 {
+		b.WriteString("; Expires=")
+		b.WriteString(c.Expires.UTC().Format(http.TimeFormat))
+	}
+	if c.MaxAge > 0 {
+		b.WriteString("; Max-Age=")
+		b.WriteString(strconv.Itoa(c.MaxAge))
+	} else if c.MaxAge < 0 {
+		b.WriteString("; Max-Age=0")
+	}
+	if c.Secure {
+		b.WriteString("; Secure")
+	}
+	if c.HttpOnly {
+		b.WriteString("; HttpOnly")
+	}
+	switch c.SameSite {
+	case http.SameSiteLaxMode:
+		b.WriteString("; SameSite=Lax")
+	case http.SameSiteStrictMode:
+		b.WriteString("; SameSite=Strict")
+	case http.SameSiteNoneMode:
+		b.WriteString("; SameSite=None")
+	}
+	if c.Partitioned {
+		b.WriteString("; Partitioned")
+	}
+	return b.String(), nil
+}
+
+// validCookieName reports whether name is an RFC 7230 token.
+func validCookieName(name string) bool {
+	if name == "" {
+		return false
+	}
+	for i := 0; i < len(name); i++ {
+		c := name[i]
+		if c <= 0x20 || c >= 0x7f || strings.IndexByte("()<>@,;:\\\"/[]?={}", c) != -1 {
+			return false
+		}
+	}
+	return true
+}
+
+// validCookieValueByte allows the RFC 6265 cookie-octets plus space and
+// comma, which are sent quoted.
+func validCookieValueByte(c byte) bool {
+	return 0x20 <= c && c < 0x7f && c != '"' && c != ';' && c != '\\'
+}
+
+func parseCookieValue(value string) (string, bool) {
+	if len(value) > 1 && value[0] == '"' && value[len(value)-1] == '"' {
+		value = value[1 : len(value)-1]
+	}
+	for i := 0; i < len(value); i++ {
+		if !validCookieValueByte(value[i]) {
+			return "", false
+		}
+	}
+	return value, true
+}
+
+func validCookieDomain(domain string) bool {
+	domain = strings.TrimPrefix(domain, ".")
+	if domain == "" || len(domain) > 255 {
+		return false
+	}
+	for i := 0; i < len(domain); i++ {
+		c := domain[i]
+		if !('a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' || '0' <= c && c <= '9' || c == '-' || c == '.' || c == ':') {
+			return false
+		}
+	}
+	return true
+}
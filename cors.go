@@ -14,8 +14,8 @@ type CorsOptions struct {
 	MaxAge           int
 }
 
-func (s *Server) handleCORS(res *Response, req *Request) {
-	if s.CorsOptions == nil {
+func handleCORS(options *CorsOptions, res *Response, req *Request) {
+	if options == nil {
 		return
 	}
 
@@ -24,36 +24,36 @@ func (s *Server) handleCORS(res *Response, req *Request) {
 		return
 	}
 
-	if len(s.CorsOptions.Origins) > 0 && s.CorsOptions.Origins[0] == "*" {
-		if s.CorsOptions.AllowCredentials {
+	if len(options.Origins) > 0 && options.Origins[0] == "*" {
+		if options.AllowCredentials {
 			res.Headers.Add("Access-Control-Allow-Origin", origin)
 		} else {
 			res.Headers.Add("Access-Control-Allow-Origin", "*")
 		}
-	} else if contains(s.CorsOptions.Origins, origin) {
+	} else if contains(options.Origins, origin) {
 		res.Headers.Add("Access-Control-Allow-Origin", origin)
 	} else {
 		// Origin not allowed
 		return
 	}
 
-	if s.CorsOptions.AllowCredentials {
+	if options.AllowCredentials {
 		res.Headers.Add("Access-Control-Allow-Credentials", "true")
 	}
 
 	if req.Method == "OPTIONS" {
-		if len(s.CorsOptions.AllowedMethods) > 0 {
-			if s.CorsOptions.AllowedMethods[0] == "*" {
+		if len(options.AllowedMethods) > 0 {
+			if options.AllowedMethods[0] == "*" {
 				res.Headers.Add("Access-Control-Allow-Methods",
 					"GET,POST,PUT,DELETE,OPTIONS,HEAD,PATCH")
 			} else {
 				res.Headers.Add("Access-Control-Allow-Methods",
-					strings.Join(s.CorsOptions.AllowedMethods, ","))
+					strings.Join(options.AllowedMethods, ","))
 			}
 		}
 
-		if len(s.CorsOptions.AllowedHeaders) > 0 {
-			if s.CorsOptions.AllowedHeaders[0] == "*" {
+		if len(options.AllowedHeaders) > 0 {
+			if options.AllowedHeaders[0] == "*" {
 				if reqHeaders, ok := req.Headers["access-control-request-headers"]; ok && reqHeaders != "" {
 					res.Headers.Add("Access-Control-Allow-Headers", reqHeaders)
 				} else {
@@ -62,18 +62,18 @@ func (s *Server) handleCORS(res *Response, req *Request) {
 				}
 			} else {
 				res.Headers.Add("Access-Control-Allow-Headers",
-					strings.Join(s.CorsOptions.AllowedHeaders, ","))
+					strings.Join(options.AllowedHeaders, ","))
 			}
 		}
 
-		if s.CorsOptions.MaxAge > 0 {
+		if options.MaxAge > 0 {
 			res.Headers.Add("Access-Control-Max-Age",
-				strconv.Itoa(s.CorsOptions.MaxAge))
+				strconv.Itoa(options.MaxAge))
 		}
 	}
 
-	if len(s.CorsOptions.ExposedHeaders) > 0 {
+	if len(options.ExposedHeaders) > 0 {
 		res.Headers.Add("Access-Control-Expose-Headers",
-			strings.Join(s.CorsOptions.ExposedHeaders, ","))
+			strings.Join(options.ExposedHeaders, ","))
 	}
 }
@@ -0,0 +1,119 @@
+package gonanoweb
+
+import (
+	"bufio"
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+const defaultMaxDecompressedSize = 10 * 1024 * 1024
+
+type DecompressionOptions struct {
+	MaxDecompressedSize *int64 // Limit on the decoded body, independent of MaxRequestSize. Nil means 10MB, negative disables it
+}
+
+func DefaultDecompressionOptions() DecompressionOptions {
+	maxDecompressedSize := int64(defaultMaxDecompressedSize)
+	return DecompressionOptions{
+		MaxDecompressedSize: &maxDecompressedSize,
+	}
+}
+
+// DecompressionMiddleware decodes gzip and deflate request bodies before
+// they reach the handler and FormData parsing. Other codings are rejected
+// with 415.
+func DecompressionMiddleware(options *DecompressionOptions) Middleware {
+	if options == nil {
+		defaultOptions := DefaultDecompressionOptions()
+		options = &defaultOptions
+	}
+
+	return Middleware{
+		Handler: func(res *Response, req *Request) error {
+			for _, coding := range contentCodings(req.Headers["content-encoding"]) {
+				if coding != "gzip" && coding != "x-gzip" && coding != "deflate" {
+					res.Headers.Set("Accept-Encoding", "gzip, deflate")
+					return ApiError{StatusCode: 415, Message: "Unsupported Content-Encoding."}.WithError(fmt.Errorf("unsupported content encoding %q", coding))
+				}
+			}
+			req.decompression = options
+			return nil
+		},
+	}
+}
+
+// contentCodings lists the codings of a Content-Encoding header in the order
+// they were applied, leaving out identity.
+func contentCodings(header string) []string {
+	var codings []string
+	for _, coding := range strings.Split(header, ",") {
+		coding = strings.ToLower(strings.TrimSpace(coding))
+		if coding != "" && coding != "identity" {
+			codings = append(codings, coding)
+		}
+	}
+	return codings
+}
+
+// decompressBody replaces the raw body with its decoded form, undoing the
+// codings in reverse order.
+func (r *Request) decompressBody() error {
+	codings := contentCodings(r.Headers["content-encoding"])
+	if len(codings) == 0 || r.Body == nil || len(*r.Body) == 0 {
+		return nil
+	}
+
+	var limit int64 = defaultMaxDecompressedSize
+	if r.decompression.MaxDecompressedSize != nil {
+		limit = *r.decompression.MaxDecompressedSize
+	}
+
+	body := *r.Body
+	for i := len(codings) - 1; i >= 0; i-- {
+		decoder, err := newDecoder(codings[i], bytes.NewReader(body))
+		if err != nil {
+			return ApiError{StatusCode: 400, Message: "Malformed compressed body."}.WithError(err)
+		}
+
+		reader := io.Reader(decoder)
+		if limit >= 0 {
+			reader = io.LimitReader(decoder, limit+1)
+		}
+		body, err = io.ReadAll(reader)
+		decoder.Close()
+		if err != nil {
+			return ApiError{StatusCode: 400, Message: "Malformed compressed body."}.WithError(err)
+		}
+		if limit >= 0 && int64(len(body)) > limit {
+			return ApiError{StatusCode: 413, Message: "Request body too large."}.WithError(fmt.Errorf("decompressed body exceeds maximum allowed size %d", limit))
+		}
+	}
+
+	r.Body = &body
+	delete(r.Headers, "content-encoding")
+	r.Headers["content-length"] = strconv.Itoa(len(body))
+	return nil
+}
+
+func newDecoder(coding string, r io.Reader) (io.ReadCloser, error) {
+	switch coding {
+	case "gzip", "x-gzip":
+		return gzip.NewReader(r)
+	case "deflate":
+		// "deflate" is meant to be zlib-wrapped, but some clients send raw
+		// deflate data.
+		br := bufio.NewReader(r)
+		header, err := br.Peek(2)
+		if err == nil && (uint16(header[0])<<8|uint16(header[1]))%31 == 0 && header[0]&0x0f == 8 {
+			return zlib.NewReader(br)
+		}
+		return flate.NewReader(br), nil
+	}
+	return nil, fmt.Errorf("unsupported content encoding %q", coding)
+}
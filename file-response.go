@@ -0,0 +1,147 @@
+package gonanoweb
+
+import (
+	"io"
+	"mime"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// File streams the file at path from disk, honoring conditional and range
+// requests. The file is sent with sendfile where the platform supports it.
+func (r *Response) File(path string) error {
+	file, err := os.Open(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return ApiError{StatusCode: 404, Message: "File not found."}.WithError(err)
+		}
+		return err
+	}
+
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return err
+	}
+	if info.IsDir() {
+		file.Close()
+		return ApiError{StatusCode: 404, Message: "File not found."}
+	}
+
+	if r.Headers.Get("Content-Type") == "" {
+		r.Headers.Set("Content-Type", detectContentType(filepath.Base(path), file))
+	}
+	etag := "\"" + strconv.FormatInt(info.ModTime().UnixNano(), 36) + "-" + strconv.FormatInt(info.Size(), 36) + "\""
+	serveContent(r, r.req, file, info.Size(), etag, info.ModTime())
+	return nil
+}
+
+// Stream sends content with the given status. For a 200 status conditional
+// and range requests are honored using modTime; name is only used to detect
+// the content type. The content is closed after sending if it is an
+// io.Closer.
+func (r *Response) Stream(status int, content io.ReadSeeker, name string, modTime time.Time) error {
+	size, err := content.Seek(0, io.SeekEnd)
+	if err != nil {
+		return err
+	}
+
+	if r.Headers.Get("Content-Type") == "" {
+		r.Headers.Set("Content-Type", detectContentType(name, content))
+	}
+
+	if status == 200 && r.req != nil {
+		serveContent(r, r.req, content, size, "", modTime)
+		return nil
+	}
+
+	if _, err := content.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	if !modTime.IsZero() {
+		r.Headers.Set("Last-Modified", modTime.UTC().Format(http.TimeFormat))
+	}
+	r.Status = status
+	r.setBodyReader(content, size)
+	return nil
+}
+
+// Attachment sends content as a download named name. Seekable content gets
+// range support; other readers are streamed until EOF.
+func (r *Response) Attachment(name string, content io.Reader) error {
+	r.Headers.Set("Content-Disposition", ContentDisposition("attachment", name))
+
+	if seeker, ok := content.(io.ReadSeeker); ok {
+		return r.Stream(200, seeker, name, time.Time{})
+	}
+
+	if r.Headers.Get("Content-Type") == "" {
+		contentType := mime.TypeByExtension(filepath.Ext(name))
+		if contentType == "" {
+			contentType = "application/octet-stream"
+		}
+		r.Headers.Set("Content-Type", contentType)
+	}
+	r.Status = 200
+	r.setBodyReader(content, -1)
+	return nil
+}
+
+// ContentDisposition builds a Content-Disposition header value with an ASCII
+// filename fallback and an RFC 5987 encoded filename* for everything else.
+func ContentDisposition(kind string, filename string) string {
+	var fallback strings.Builder
+	ascii := true
+	for _, c := range filename {
+		switch {
+		case c < 0x20 || c == 0x7f || c == '"' || c == '\\':
+			fallback.WriteByte('_')
+		case c > 0x7e:
+			fallback.WriteByte('_')
+			ascii = false
+		default:
+			fallback.WriteRune(c)
+		}
+	}
+
+	value := kind + "; filename=\"" + fallback.String() + "\""
+	if !ascii || fallback.String() != filename {
+		value += "; filename*=UTF-8''" + encodeRFC5987(filename)
+	}
+	return value
+}
+
+func encodeRFC5987(s string) string {
+	const hex = "0123456789ABCDEF"
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if ('a' <= c && c <= 'z') || ('A' <= c && c <= 'Z') || ('0' <= c && c <= '9') ||
+			strings.IndexByte("!#$&+-.^_`|~", c) != -1 {
+			b.WriteByte(c)
+			continue
+		}
+		b.WriteByte('%')
+		b.WriteByte(hex[c>>4])
+		b.WriteByte(hex[c&0x0f])
+	}
+	return b.String()
+}
+
+// detectContentType uses the file extension, falling back to sniffing the
+// first 512 bytes of content. The content is left positioned at its start.
+func detectContentType(name string, content io.ReadSeeker) string {
+	if contentType := mime.TypeByExtension(filepath.Ext(name)); contentType != "" {
+		return contentType
+	}
+
+	var sniff [512]byte
+	content.Seek(0, io.SeekStart)
+	n, _ := io.ReadFull(content, sniff[:])
+	content.Seek(0, io.SeekStart)
+	return http.DetectContentType(sniff[:n])
+}
@@ -3,16 +3,27 @@ package gonanoweb
 import (
 	"bytes"
 	"errors"
+	"fmt"
 	"io"
+	"math"
+	"mime"
 	"mime/multipart"
+	"net/http"
 	"net/textproto"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
 )
 
 type FormFile struct {
 	Filename string
 	Header   textproto.MIMEHeader
 	Size     int64
-	Reader   io.Reader
+	Reader   io.Reader         // Nil when the file was written to an UploadStore
+	Location string            // Where the UploadStore put the file
+	Hashes   map[string]string // Hex digests keyed by algorithm, see FormDataOptions.Hashes
 }
 
 type FormData struct {
@@ -21,10 +32,22 @@ type FormData struct {
 }
 
 type FormDataOptions struct {
-	MaxMemory       int64  // Maximum size in memory before using temp files
+	MaxMemory       int64  // Maximum size in memory before using temp files, 0 means 10 MB
 	MaxFileSize     int64  // Maximum size of individual files
 	TempDir         string // Temporary files Directory
 	StreamingParser bool   // Whether to enable streaming parser
+	MaxFormSize     int64  // Maximum size of an urlencoded body
+	MaxFields       int    // Maximum number of urlencoded fields
+
+	MaxParts          int      // Maximum number of multipart parts, 0 means unlimited
+	MaxFiles          int      // Maximum number of files, 0 means unlimited
+	MaxFieldSize      int64    // Maximum size of a single text field, 0 means unlimited
+	MaxTotalSize      int64    // Maximum size of all parts together, 0 means the request size limit (10 MB by default)
+	AllowedMimeTypes  []string // Sniffed file types accepted, e.g. "image/png" or "image/*"; empty allows any
+	AllowedExtensions []string // File name extensions accepted, e.g. ".png"; empty allows any
+
+	Hashes []string    // Digests computed while reading files: "sha256", "md5"
+	Store  UploadStore // Stream files straight into this store instead of memory/TempDir
 }
 
 func DefaultFormDataOptions() FormDataOptions {
@@ -33,54 +56,346 @@ func DefaultFormDataOptions() FormDataOptions {
 		MaxFileSize:     32 << 20, // 32 MB
 		TempDir:         "",
 		StreamingParser: false,
+		MaxFormSize:     10 << 20, // 10 MB
+		MaxFields:       1000,
+		MaxParts:        1000,
+		MaxFiles:        100,
+		MaxFieldSize:    1 << 20, // 1 MB
+		MaxTotalSize:    0,
+	}
+}
+
+// FormDataMiddleware enables multipart parsing for the routes it is applied
+// to. With nil options the server's FormDataOptions (or the defaults) are
+// used. With StreamingParser set the body is left unread and handlers get
+// the parts from GetMultipartReader.
+func FormDataMiddleware(options *FormDataOptions) Middleware {
+	return Middleware{
+		Handler: func(res *Response, req *Request) error {
+			if options != nil {
+				req.formOptions = options
+			} else {
+				req.formOptions = req.formDataOptions()
+			}
+			return nil
+		},
+	}
+}
+
+// GetFormData returns the parsed form of the request. In streaming mode it
+// returns an empty FormData for the handler to fill while reading the parts.
+func GetFormData(req *Request) (*FormData, error) {
+	if req.FormData != nil {
+		return req.FormData, nil
 	}
+
+	if req.MultipartReader != nil {
+		req.FormData = &FormData{
+			Fields: make(map[string][]string),
+			Files:  make(map[string][]*FormFile),
+		}
+		return req.FormData, nil
+	}
+
+	return nil, formDataError(req)
 }
 
-func parseEntireForm(reader *multipart.Reader, options *FormDataOptions) (*FormData, error) {
+// GetMultipartReader returns the reader over the parts of a multipart body
+// on routes using FormDataMiddleware with StreamingParser.
+func GetMultipartReader(req *Request) (*multipart.Reader, error) {
+	if req.MultipartReader != nil {
+		return req.MultipartReader, nil
+	}
+	if req.formOptions != nil && !req.formOptions.StreamingParser {
+		return nil, errors.New("multipart body was already parsed, enable StreamingParser to read it as a stream")
+	}
+	return nil, formDataError(req)
+}
+
+func formDataError(req *Request) error {
+	mediaType, _, _ := mime.ParseMediaType(req.Headers["content-type"])
+	switch mediaType {
+	case "multipart/form-data":
+		if req.formOptions == nil {
+			return errors.New("multipart body not parsed, FormDataMiddleware is not applied to this route")
+		}
+		return ApiError{StatusCode: 400, Message: "Malformed multipart body."}
+	case "application/x-www-form-urlencoded":
+		return ApiError{StatusCode: 400, Message: "Malformed form body."}
+	}
+	return ApiError{StatusCode: 415, Message: "Expected form data."}.WithError(fmt.Errorf("content type %q is not a form", mediaType))
+}
+
+// parseEntireForm reads every part of reader. Fields and files are kept in
+// memory up to MaxMemory in total; files beyond that are written to temp
+// files in TempDir, which are removed once the request is done.
+func (r *Request) parseEntireForm(reader *multipart.Reader, options *FormDataOptions) (*FormData, error) {
 	formData := &FormData{
 		Fields: make(map[string][]string),
 		Files:  make(map[string][]*FormFile),
 	}
 
+	if err := r.parseParts(reader, options, formData); err != nil {
+		// Files already handed to the store belong to a failed request.
+		if options.Store != nil {
+			for _, files := range formData.Files {
+				for _, file := range files {
+					options.Store.Delete(file.Location)
+				}
+			}
+		}
+		return nil, err
+	}
+	return formData, nil
+}
+
+func (r *Request) parseParts(reader *multipart.Reader, options *FormDataOptions, formData *FormData) error {
+	remaining := options.MaxMemory
+	if remaining <= 0 {
+		remaining = DefaultFormDataOptions().MaxMemory
+	}
+	totalRemaining := limitOrMax(options.MaxTotalSize)
+	parts, files := 0, 0
+
 	for {
 		part, err := reader.NextPart()
 		if err == io.EOF {
 			break
 		}
 		if err != nil {
-			return nil, err
+			return ApiError{StatusCode: 400, Message: "Malformed multipart body."}.WithError(err)
 		}
 
+		// Nameless parts are skipped but still count, so they cannot be
+		// used to get around MaxParts.
 		name := part.FormName()
+		parts++
+		if options.MaxParts > 0 && parts > options.MaxParts {
+			return formLimitError(413, name, "maxParts", "Too many parts in form.")
+		}
 		if name == "" {
+			part.Close()
 			continue
 		}
 
 		filename := part.FileName()
-		if filename != "" {
-			var buffer bytes.Buffer
-			size, err := io.CopyN(&buffer, part, options.MaxFileSize+1)
-			if err != nil && err != io.EOF {
-				return nil, err
+		if filename == "" {
+			limit := min(limitOrMax(options.MaxFieldSize), remaining, totalRemaining)
+			value, err := io.ReadAll(io.LimitReader(part, limit+1))
+			if err != nil {
+				return err
 			}
-			if size > options.MaxFileSize {
-				return nil, errors.New("file exceeds maximum allowed size")
+			size := int64(len(value))
+			switch {
+			case options.MaxFieldSize > 0 && size > options.MaxFieldSize:
+				return formLimitError(413, name, "maxFieldSize", "Form field too large.")
+			case size > totalRemaining:
+				return formLimitError(413, name, "maxTotalSize", "Form data too large.")
+			case size > remaining:
+				return formLimitError(413, name, "maxMemory", "Form data too large.")
 			}
+			remaining -= size
+			totalRemaining -= size
+			formData.Fields[name] = append(formData.Fields[name], string(value))
+			continue
+		}
+
+		files++
+		if options.MaxFiles > 0 && files > options.MaxFiles {
+			return formLimitError(413, name, "maxFiles", "Too many files in form.")
+		}
+
+		content, err := checkFileType(name, filename, part, options)
+		if err != nil {
+			return err
+		}
 
-			formFile := &FormFile{
-				Filename: filename,
-				Header:   part.Header,
-				Size:     size,
-				Reader:   bytes.NewReader(buffer.Bytes()),
+		hashes, content, err := hashingReader(content, options.Hashes)
+		if err != nil {
+			return err
+		}
+		formFile := &FormFile{
+			Filename: filename,
+			Header:   part.Header,
+		}
+
+		var size int64
+		maxFileSize := min(limitOrMax(options.MaxFileSize), totalRemaining)
+		if options.Store != nil {
+			counted := &countingReader{reader: io.LimitReader(content, maxFileSize+1)}
+			location, err := options.Store.Put(filename, counted)
+			if err != nil {
+				return err
+			}
+			size = counted.n
+			formFile.Location = location
+			if size > maxFileSize {
+				options.Store.Delete(location)
 			}
-			formData.Files[name] = append(formData.Files[name], formFile)
 		} else {
-			value, err := io.ReadAll(part)
-			if err != nil {
-				return nil, err
+			var buffer bytes.Buffer
+			size, err = io.CopyN(&buffer, content, min(remaining, maxFileSize)+1)
+			if err != nil && err != io.EOF {
+				return err
 			}
-			formData.Fields[name] = append(formData.Fields[name], string(value))
+
+			if size <= remaining {
+				remaining -= size
+				formFile.Reader = bytes.NewReader(buffer.Bytes())
+			} else {
+				// Never write more than one byte past the limits to disk.
+				file, err := r.spillToTempFile(&buffer, content, max(maxFileSize+1-size, 0), options.TempDir)
+				if err != nil {
+					return err
+				}
+				info, err := file.Stat()
+				if err != nil {
+					return err
+				}
+				size = info.Size()
+				formFile.Reader = file
+			}
+		}
+
+		switch {
+		case options.MaxFileSize > 0 && size > options.MaxFileSize:
+			return formLimitError(413, name, "maxFileSize", "File too large.")
+		case size > totalRemaining:
+			return formLimitError(413, name, "maxTotalSize", "Form data too large.")
+		}
+		totalRemaining -= size
+		formFile.Size = size
+		formFile.Hashes = hashes.sums()
+		formData.Files[name] = append(formData.Files[name], formFile)
+	}
+
+	return nil
+}
+
+func limitOrMax(limit int64) int64 {
+	if limit <= 0 {
+		return math.MaxInt64 - 1
+	}
+	return limit
+}
+
+// checkFileType sniffs the first 512 bytes of a file part and checks them
+// and the file name against the allowed types. The returned reader yields
+// the whole part again.
+func checkFileType(field string, filename string, part io.Reader, options *FormDataOptions) (io.Reader, error) {
+	if len(options.AllowedExtensions) > 0 {
+		ext := strings.ToLower(filepath.Ext(filename))
+		if !slices.ContainsFunc(options.AllowedExtensions, func(allowed string) bool { return strings.EqualFold(allowed, ext) }) {
+			return nil, formLimitError(415, field, "extension", "File type not allowed.")
+		}
+	}
+
+	if len(options.AllowedMimeTypes) == 0 {
+		return part, nil
+	}
+
+	head := make([]byte, 512)
+	n, err := io.ReadFull(part, head)
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return nil, err
+	}
+	head = head[:n]
+
+	sniffed, _, _ := mime.ParseMediaType(http.DetectContentType(head))
+	allowed := false
+	for _, pattern := range options.AllowedMimeTypes {
+		if prefix, ok := strings.CutSuffix(pattern, "/*"); ok {
+			allowed = strings.HasPrefix(sniffed, prefix+"/")
+		} else {
+			allowed = strings.EqualFold(pattern, sniffed)
+		}
+		if allowed {
+			break
+		}
+	}
+	if !allowed {
+		return nil, formLimitError(415, field, "mimeType", "File type not allowed.").WithError(fmt.Errorf("field %q: sniffed content type %q is not allowed", field, sniffed))
+	}
+
+	return io.MultiReader(bytes.NewReader(head), part), nil
+}
+
+// formLimitError names the offending field in the message and in Details,
+// using the same shape as validation errors.
+func formLimitError(status int, field string, rule string, message string) ApiError {
+	return ApiError{
+		StatusCode: status,
+		Message:    fmt.Sprintf("%s Offending field: %q.", message, field),
+		Details:    ValidationErrors{{Field: field, Rule: rule, Message: message}},
+	}.WithError(fmt.Errorf("field %q: %s", field, message))
+}
+
+// spillToTempFile writes what was buffered so far plus up to limit more bytes
+// of part to a new temp file, rewound for reading.
+func (r *Request) spillToTempFile(buffered io.Reader, part io.Reader, limit int64, dir string) (*os.File, error) {
+	file, err := os.CreateTemp(dir, "gonanoweb-upload-")
+	if err != nil {
+		return nil, err
+	}
+	r.tempFiles = append(r.tempFiles, file)
+
+	if _, err := io.Copy(file, buffered); err != nil {
+		return nil, err
+	}
+	if _, err := io.CopyN(file, part, limit); err != nil && err != io.EOF {
+		return nil, err
+	}
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+	return file, nil
+}
+
+// removeTempFiles closes and deletes the temp files created for uploads.
+func (r *Request) removeTempFiles() {
+	for _, file := range r.tempFiles {
+		file.Close()
+		os.Remove(file.Name())
+	}
+	clear(r.tempFiles)
+	r.tempFiles = r.tempFiles[:0]
+}
+
+// parseURLEncodedForm decodes an application/x-www-form-urlencoded body into
+// FormData.Fields.
+func parseURLEncodedForm(body []byte, options *FormDataOptions) (*FormData, error) {
+	if options.MaxFormSize > 0 && int64(len(body)) > options.MaxFormSize {
+		return nil, ApiError{StatusCode: 413, Message: "Form body too large."}.WithError(fmt.Errorf("form body of %d bytes exceeds maximum %d", len(body), options.MaxFormSize))
+	}
+
+	formData := &FormData{
+		Fields: make(map[string][]string),
+		Files:  make(map[string][]*FormFile),
+	}
+
+	fields := 0
+	for query := string(body); query != ""; {
+		var pair string
+		pair, query, _ = strings.Cut(query, "&")
+		if pair == "" {
+			continue
+		}
+
+		fields++
+		if options.MaxFields > 0 && fields > options.MaxFields {
+			return nil, ApiError{StatusCode: 413, Message: "Too many form fields."}.WithError(fmt.Errorf("form has more than %d fields", options.MaxFields))
+		}
+
+		key, value, _ := strings.Cut(pair, "=")
+		key, err := url.QueryUnescape(key)
+		if err != nil {
+			return nil, ApiError{StatusCode: 400, Message: "Malformed form body."}.WithError(err)
+		}
+		value, err = url.QueryUnescape(value)
+		if err != nil {
+			return nil, ApiError{StatusCode: 400, Message: "Malformed form body."}.WithError(err)
 		}
+		formData.Fields[key] = append(formData.Fields[key], value)
 	}
 
 	return formData, nil
@@ -0,0 +1,267 @@
+package gonanoweb
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"mime/multipart"
+	"net/textproto"
+	"os"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+type testPart struct {
+	name     string
+	filename string
+	content  string
+}
+
+func multipartReader(t *testing.T, parts ...testPart) *multipart.Reader {
+	t.Helper()
+	var body bytes.Buffer
+	writer := multipart.NewWriter(&body)
+	for _, p := range parts {
+		header := textproto.MIMEHeader{}
+		switch {
+		case p.name == "":
+			header.Set("Content-Disposition", "form-data")
+		case p.filename != "":
+			header.Set("Content-Disposition", `form-data; name="`+p.name+`"; filename="`+p.filename+`"`)
+			header.Set("Content-Type", "application/octet-stream")
+		default:
+			header.Set("Content-Disposition", `form-data; name="`+p.name+`"`)
+		}
+		w, err := writer.CreatePart(header)
+		if err != nil {
+			t.Fatal(err)
+		}
+		io.WriteString(w, p.content)
+	}
+	writer.Close()
+	return multipart.NewReader(&body, writer.Boundary())
+}
+
+var pngHeader = "\x89PNG\r\n\x1a\n\x00\x00\x00\rIHDR"
+
+func TestParseEntireFormLimits(t *testing.T) {
+	tests := []struct {
+		name       string
+		options    FormDataOptions
+		parts      []testPart
+		wantStatus int    // 0 means success
+		wantRule   string // rule reported in Details
+	}{
+		{name: "zero options accept fields", parts: []testPart{{name: "a", content: "hello"}, {name: "f", filename: "f.txt", content: "data"}}},
+		{name: "parts at limit", options: FormDataOptions{MaxParts: 2}, parts: []testPart{{name: "a"}, {name: "b"}}},
+		{name: "parts over limit", options: FormDataOptions{MaxParts: 2}, parts: []testPart{{name: "a"}, {name: "b"}, {name: "c"}}, wantStatus: 413, wantRule: "maxParts"},
+		{name: "nameless parts count", options: FormDataOptions{MaxParts: 2}, parts: []testPart{{}, {}, {}}, wantStatus: 413, wantRule: "maxParts"},
+		{name: "files over limit", options: FormDataOptions{MaxFiles: 1}, parts: []testPart{{name: "f", filename: "a.txt"}, {name: "f", filename: "b.txt"}}, wantStatus: 413, wantRule: "maxFiles"},
+		{name: "field at limit", options: FormDataOptions{MaxFieldSize: 5}, parts: []testPart{{name: "a", content: "12345"}}},
+		{name: "field over limit", options: FormDataOptions{MaxFieldSize: 5}, parts: []testPart{{name: "a", content: "123456"}}, wantStatus: 413, wantRule: "maxFieldSize"},
+		{name: "file at limit", options: FormDataOptions{MaxFileSize: 4}, parts: []testPart{{name: "f", filename: "a.txt", content: "1234"}}},
+		{name: "file over limit", options: FormDataOptions{MaxFileSize: 4}, parts: []testPart{{name: "f", filename: "a.txt", content: "12345"}}, wantStatus: 413, wantRule: "maxFileSize"},
+		{name: "total at limit", options: FormDataOptions{MaxTotalSize: 10}, parts: []testPart{{name: "a", content: "12345"}, {name: "f", filename: "a.txt", content: "12345"}}},
+		{name: "total over limit", options: FormDataOptions{MaxTotalSize: 10}, parts: []testPart{{name: "a", content: "123456"}, {name: "b", content: "123456"}}, wantStatus: 413, wantRule: "maxTotalSize"},
+		{name: "total over limit with file", options: FormDataOptions{MaxTotalSize: 10}, parts: []testPart{{name: "a", content: "123456"}, {name: "f", filename: "a.txt", content: "123456"}}, wantStatus: 413, wantRule: "maxTotalSize"},
+		{name: "memory over limit", options: FormDataOptions{MaxMemory: 4}, parts: []testPart{{name: "a", content: "12345"}}, wantStatus: 413, wantRule: "maxMemory"},
+		{name: "extension allowed", options: FormDataOptions{AllowedExtensions: []string{".png"}}, parts: []testPart{{name: "f", filename: "A.PNG", content: pngHeader}}},
+		{name: "extension rejected", options: FormDataOptions{AllowedExtensions: []string{".png"}}, parts: []testPart{{name: "f", filename: "a.png.exe"}}, wantStatus: 415, wantRule: "extension"},
+		{name: "extension missing", options: FormDataOptions{AllowedExtensions: []string{".png"}}, parts: []testPart{{name: "f", filename: "png"}}, wantStatus: 415, wantRule: "extension"},
+		{name: "mime type allowed", options: FormDataOptions{AllowedMimeTypes: []string{"image/png"}}, parts: []testPart{{name: "f", filename: "a.bin", content: pngHeader}}},
+		{name: "mime wildcard allowed", options: FormDataOptions{AllowedMimeTypes: []string{"image/*"}}, parts: []testPart{{name: "f", filename: "a.bin", content: pngHeader}}},
+		{name: "mime type sniffed not declared", options: FormDataOptions{AllowedMimeTypes: []string{"image/*"}}, parts: []testPart{{name: "f", filename: "a.png", content: "<html><script>"}}, wantStatus: 415, wantRule: "mimeType"},
+		{name: "empty file sniffed", options: FormDataOptions{AllowedMimeTypes: []string{"image/png"}}, parts: []testPart{{name: "f", filename: "a.png"}}, wantStatus: 415, wantRule: "mimeType"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := NewRequest()
+			defer req.removeTempFiles()
+
+			formData, err := req.parseEntireForm(multipartReader(t, tt.parts...), &tt.options)
+			if tt.wantStatus == 0 {
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				if formData == nil {
+					t.Fatal("expected form data")
+				}
+				return
+			}
+
+			var apiErr ApiError
+			if !errors.As(err, &apiErr) {
+				t.Fatalf("expected an ApiError, got %v", err)
+			}
+			if apiErr.StatusCode != tt.wantStatus {
+				t.Errorf("got status %d, want %d", apiErr.StatusCode, tt.wantStatus)
+			}
+			details, ok := apiErr.Details.(ValidationErrors)
+			if !ok || len(details) != 1 || details[0].Rule != tt.wantRule {
+				t.Errorf("got details %+v, want rule %q", apiErr.Details, tt.wantRule)
+			}
+		})
+	}
+}
+
+func TestParseEntireFormContents(t *testing.T) {
+	req := NewRequest()
+	defer req.removeTempFiles()
+
+	formData, err := req.parseEntireForm(multipartReader(t,
+		testPart{name: "a", content: "one"},
+		testPart{name: "a", content: "two"},
+		testPart{},
+		testPart{name: "f", filename: "hello.txt", content: "hello"},
+	), &FormDataOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got := strings.Join(formData.Fields["a"], ","); got != "one,two" {
+		t.Errorf("got fields %q", got)
+	}
+	files := formData.Files["f"]
+	if len(files) != 1 || files[0].Filename != "hello.txt" || files[0].Size != 5 {
+		t.Fatalf("got files %+v", files)
+	}
+	content, _ := io.ReadAll(files[0].Reader)
+	if string(content) != "hello" {
+		t.Errorf("got file content %q", content)
+	}
+}
+
+func TestParseEntireFormSpillsToTempFile(t *testing.T) {
+	dir := t.TempDir()
+	req := NewRequest()
+
+	formData, err := req.parseEntireForm(multipartReader(t,
+		testPart{name: "f", filename: "big.bin", content: strings.Repeat("x", 100)},
+	), &FormDataOptions{MaxMemory: 10, TempDir: dir})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	file, ok := formData.Files["f"][0].Reader.(*os.File)
+	if !ok {
+		t.Fatalf("expected the file to be spilled, got %T", formData.Files["f"][0].Reader)
+	}
+	content, _ := io.ReadAll(file)
+	if len(content) != 100 || formData.Files["f"][0].Size != 100 {
+		t.Errorf("got %d bytes, size %d", len(content), formData.Files["f"][0].Size)
+	}
+
+	req.removeTempFiles()
+	if entries, _ := os.ReadDir(dir); len(entries) != 0 {
+		t.Errorf("temp files left behind: %v", entries)
+	}
+}
+
+func TestParseEntireFormMalformed(t *testing.T) {
+	body := "--XX\r\nContent-Disposition: form-data; name=\"a\"\r\n\r\nvalue"
+	reader := multipart.NewReader(strings.NewReader(body), "XX")
+
+	req := NewRequest()
+	_, err := req.parseEntireForm(reader, &FormDataOptions{})
+	if err == nil {
+		t.Fatal("expected an error for a body without a closing boundary")
+	}
+}
+
+func TestFormDataMiddlewareIsPerRoute(t *testing.T) {
+	var parsed map[string]bool
+	handler := func(res *Response, req *Request) error {
+		parsed[req.Path] = req.FormData != nil
+		res.Status = 204
+		res.Body = nil
+		return nil
+	}
+
+	options := DefaultFormDataOptions()
+	s := NewServer(":0", nil)
+	s.Post("/a", handler, FormDataMiddleware(&options))
+	s.Post("/b", handler)
+
+	body := "--XX\r\nContent-Disposition: form-data; name=\"a\"\r\n\r\nvalue\r\n--XX--\r\n"
+	parsed = map[string]bool{}
+	for _, path := range []string{"/a", "/b"} {
+		serveRaw(t, s, "POST "+path+" HTTP/1.1\r\nHost: example.com\r\n"+
+			"Content-Type: multipart/form-data; boundary=XX\r\n"+
+			"Content-Length: "+strconv.Itoa(len(body))+"\r\n\r\n"+body)
+	}
+	if !parsed["/a"] {
+		t.Error("/a: expected the form to be parsed")
+	}
+	if parsed["/b"] {
+		t.Error("/b: FormData is set on a route without FormDataMiddleware")
+	}
+
+	for _, route := range s.Routes() {
+		if route.Path == "/b" && len(route.Middlewares) != 0 {
+			t.Errorf("/b lists middlewares %v", route.Middlewares)
+		}
+		if route.Path == "/a" && len(route.Middlewares) != 1 {
+			t.Errorf("/a lists middlewares %v, want FormDataMiddleware", route.Middlewares)
+		}
+	}
+}
+
+func TestMultipartStreamDefaultLimit(t *testing.T) {
+	part := "--XX\r\nContent-Disposition: form-data; name=\"a\"\r\n\r\n" + strings.Repeat("x", defaultMaxRequestSize+1) + "\r\n--XX--\r\n"
+	tests := []struct {
+		name       string
+		options    FormDataOptions
+		head       string // sent without the body when set
+		wantStatus int
+	}{
+		{name: "parts over the default total", options: FormDataOptions{}, wantStatus: 413},
+		{name: "parts within an explicit total", options: FormDataOptions{MaxTotalSize: 2 * defaultMaxRequestSize, MaxMemory: 2 * defaultMaxRequestSize}, wantStatus: 204},
+		{name: "streaming parser over the default total", options: FormDataOptions{StreamingParser: true}, head: strconv.Itoa(defaultMaxRequestSize + 1), wantStatus: 413},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := NewServer(":0", nil)
+			s.Post("/upload", func(res *Response, req *Request) error {
+				res.Status = 204
+				res.Body = nil
+				return nil
+			}, FormDataMiddleware(&tt.options))
+
+			length, body := strconv.Itoa(len(part)), part
+			if tt.head != "" {
+				length, body = tt.head, ""
+			}
+			res, body := serveRaw(t, s, "POST /upload HTTP/1.1\r\nHost: example.com\r\n"+
+				"Content-Type: multipart/form-data; boundary=XX\r\n"+
+				"Content-Length: "+length+"\r\n\r\n"+body)
+			if res.StatusCode != tt.wantStatus {
+				t.Errorf("got status %d (%s), want %d", res.StatusCode, body, tt.wantStatus)
+			}
+		})
+	}
+}
+
+func TestBindFormWithoutFormDataMiddleware(t *testing.T) {
+	s := NewServer(":0", nil)
+	s.Post("/form", func(res *Response, req *Request) error {
+		var form struct {
+			A string `form:"a"`
+		}
+		if err := req.BindForm(&form); err != nil {
+			return err
+		}
+		res.Raw(200, []byte(form.A))
+		return nil
+	})
+
+	body := "--XX\r\nContent-Disposition: form-data; name=\"a\"\r\n\r\nvalue\r\n--XX--\r\n"
+	res, _ := serveRaw(t, s, "POST /form HTTP/1.1\r\nHost: example.com\r\n"+
+		"Content-Type: multipart/form-data; boundary=XX\r\n"+
+		"Content-Length: "+strconv.Itoa(len(body))+"\r\n\r\n"+body)
+	if res.StatusCode != 500 {
+		t.Errorf("got status %d, want 500 for a multipart body that was never parsed", res.StatusCode)
+	}
+}
@@ -24,8 +24,17 @@ type Route struct {
 	Path    string
 	Method  string
 	Handler Handler
+	name    string
+
+	middlewares []Middleware
 }
 
 func (r Route) GetStack() []IStackable {
 	return []IStackable{}
 }
+
+// Name names the route so its URL can be built with Server.URL.
+func (r *Route) Name(name string) *Route {
+	r.name = name
+	return r
+}
@@ -0,0 +1,129 @@
+package gonanoweb
+
+import (
+	"errors"
+	"time"
+)
+
+// ErrorHandler turns an error returned by a handler or middleware into a
+// response.
+type ErrorHandler func(res *Response, req *Request, err error)
+
+// Group creates a sub-router mounted at path. Middlewares passed here and
+// registered inside fn only run for routes of the group, and settings such as
+// MaxRequestSize, timeouts, CorsOptions or ErrorHandler can be set on the
+// returned router (or on g inside fn) to apply to the whole subtree.
+//
+//	api.Group("/v1", func(g *gonanoweb.Router) {
+//		g.MaxRequestSize = &limit
+//		g.Get("/users/:id", getUser)
+//	}, authMiddleware)
+func (r *Router) Group(path string, fn func(g *Router), middlewares ...Middleware) *Router {
+	group := newGroup(path, fn, middlewares)
+	r.UseRouter(path, group)
+	return group
+}
+
+func (s *Server) Group(path string, fn func(g *Router), middlewares ...Middleware) *Router {
+	group := newGroup(path, fn, middlewares)
+	s.UseRouter(path, group)
+	return group
+}
+
+func newGroup(path string, fn func(g *Router), middlewares []Middleware) *Router {
+	validatePath(path)
+	group := NewRouter()
+	for _, m := range middlewares {
+		group.UseMiddleware(m)
+	}
+	if fn != nil {
+		fn(group)
+	}
+	return group
+}
+
+// The helpers below resolve a per-router setting for the matched route:
+// req.routers is ordered from the innermost router outwards, so the closest
+// router that sets a value wins, falling back to the server's value.
+
+func (r *Request) corsOptions() *CorsOptions {
+	for _, router := range r.routers {
+		if router.CorsOptions != nil {
+			return router.CorsOptions
+		}
+	}
+	return r.server.CorsOptions
+}
+
+func (r *Request) maxRequestSize() *int64 {
+	for _, router := range r.routers {
+		if router.MaxRequestSize != nil {
+			return router.MaxRequestSize
+		}
+	}
+	return r.server.MaxRequestSize
+}
+
+func (r *Request) readTimeout() *time.Duration {
+	for _, router := range r.routers {
+		if router.ReadTimeout != nil {
+			return router.ReadTimeout
+		}
+	}
+	return nil
+}
+
+func (r *Request) writeTimeout() *time.Duration {
+	for _, router := range r.routers {
+		if router.WriteTimeout != nil {
+			return router.WriteTimeout
+		}
+	}
+	return nil
+}
+
+func (r *Request) errorHandler() ErrorHandler {
+	for _, router := range r.routers {
+		if router.ErrorHandler != nil {
+			return router.ErrorHandler
+		}
+	}
+	if r.server.ErrorHandler != nil {
+		return r.server.ErrorHandler
+	}
+	return DefaultErrorHandler
+}
+
+// applyRouteSettings applies the settings of the routers enclosing the matched
+// route to the request and its connection.
+func (r *Request) applyRouteSettings() {
+	r.MaxRequestSize = r.maxRequestSize()
+
+	if r.conn == nil {
+		return
+	}
+	if timeout := r.readTimeout(); timeout != nil && *timeout > 0 {
+		(*r.conn).SetReadDeadline(time.Now().Add(*timeout))
+	}
+	if timeout := r.writeTimeout(); timeout != nil && *timeout > 0 {
+		(*r.conn).SetWriteDeadline(time.Now().Add(*timeout))
+	}
+}
+
+// DefaultErrorHandler is used when neither the matched routers nor the server
+// define an ErrorHandler. ApiErrors carry their own status; otherwise a
+// response that was already rejected with an error status (e.g. 429 from the
+// rate limiter) is kept as is, and anything else becomes a 500.
+func DefaultErrorHandler(res *Response, req *Request, err error) {
+	var apiErr ApiError
+	if errors.As(err, &apiErr) {
+		res.apiErrorDetails(apiErr)
+		return
+	}
+
+	if res.Status >= 400 {
+		return
+	}
+
+	res.ApiError(500, err.Error())
+}
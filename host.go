@@ -0,0 +1,91 @@
+package gonanoweb
+
+import (
+	"log"
+	"net"
+	"strings"
+)
+
+type hostRoute struct {
+	pattern string
+	labels  []string
+	router  *Router
+}
+
+// Host mounts router for requests whose host matches pattern. A pattern is a
+// host name whose labels may be :params, e.g. "api.example.com" or
+// ":tenant.example.com"; matched labels are added to req.Params. Hosts are
+// tried in registration order before any path matching, and requests for
+// hosts that match no pattern fall back to the routes registered on the
+// server itself. Middlewares registered on the server run for every host.
+func (s *Server) Host(pattern string, router *Router) {
+	pattern = strings.ToLower(strings.TrimSuffix(pattern, "."))
+	if pattern == "" || strings.ContainsAny(pattern, "/ ") {
+		log.Panicf("invalid host pattern %q", pattern)
+	}
+
+	router.Path = ""
+	s.hosts = append(s.hosts, hostRoute{
+		pattern: pattern,
+		labels:  strings.Split(pattern, "."),
+		router:  router,
+	})
+}
+
+// matchHost returns the router and host params for the request's host, or a
+// nil router if the default host applies.
+func (s *Server) matchHost(req *Request) (*Router, map[string]string) {
+	if len(s.hosts) == 0 {
+		return nil, nil
+	}
+
+	host := stripPort(req.Host())
+	host = strings.ToLower(strings.TrimSuffix(host, "."))
+	if host == "" {
+		return nil, nil
+	}
+	labels := strings.Split(host, ".")
+
+	for _, h := range s.hosts {
+		if len(h.labels) != len(labels) {
+			continue
+		}
+
+		var params map[string]string
+		match := true
+		for i, label := range h.labels {
+			if strings.HasPrefix(label, ":") {
+				if params == nil {
+					params = make(map[string]string)
+				}
+				params[label[1:]] = labels[i]
+			} else if label != labels[i] {
+				match = false
+				break
+			}
+		}
+
+		if match {
+			return h.router, params
+		}
+	}
+	return nil, nil
+}
+
+// middlewares returns the middlewares registered directly on the server.
+func (s *Server) middlewares() []Middleware {
+	var middlewares []Middleware
+	for _, stackable := range s.Stack {
+		if m, ok := stackable.(Middleware); ok {
+			middlewares = append(middlewares, m)
+		}
+	}
+	return middlewares
+}
+
+func stripPort(host string) string {
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		return h
+	}
+	return strings.Trim(host, "[]")
+}
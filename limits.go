@@ -0,0 +1,217 @@
+package gonanoweb
+
+import (
+	"io"
+	"net"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+type OverloadPolicy int
+
+const (
+	OverloadReject       OverloadPolicy = iota // Answer 503 with Retry-After and close
+	OverloadBackpressure                       // Stop accepting / wait for a free slot
+)
+
+// ServerStats is a snapshot of the server's connection and request counters.
+type ServerStats struct {
+	ActiveConnections   int64
+	ActiveRequests      int64
+	TotalConnections    int64
+	TotalRequests       int64
+	RejectedConnections int64
+	RejectedRequests    int64
+}
+
+type serverLimits struct {
+	connections chan struct{}
+	requests    chan struct{}
+
+	perIPMu sync.Mutex
+	perIP   map[string]int
+
+	activeConnections   atomic.Int64
+	activeRequests      atomic.Int64
+	totalConnections    atomic.Int64
+	totalRequests       atomic.Int64
+	rejectedConnections atomic.Int64
+	rejectedRequests    atomic.Int64
+}
+
+func (s *Server) setupLimits() {
+	if s.MaxConnections != nil && *s.MaxConnections > 0 {
+		s.limits.connections = make(chan struct{}, *s.MaxConnections)
+	}
+	if s.MaxConcurrentRequests != nil && *s.MaxConcurrentRequests > 0 {
+		s.limits.requests = make(chan struct{}, *s.MaxConcurrentRequests)
+	}
+	if s.MaxConnectionsPerIP != nil && *s.MaxConnectionsPerIP > 0 {
+		s.limits.perIP = make(map[string]int)
+	}
+}
+
+// Stats returns the current connection and request counters.
+func (s *Server) Stats() ServerStats {
+	return ServerStats{
+		ActiveConnections:   s.limits.activeConnections.Load(),
+		ActiveRequests:      s.limits.activeRequests.Load(),
+		TotalConnections:    s.limits.totalConnections.Load(),
+		TotalRequests:       s.limits.totalRequests.Load(),
+		RejectedConnections: s.limits.rejectedConnections.Load(),
+		RejectedRequests:    s.limits.rejectedRequests.Load(),
+	}
+}
+
+// acquireConnectionSlot is called by the accept loop before Accept when
+// backpressure is configured, so excess clients wait in the kernel backlog.
+func (s *Server) acquireConnectionSlot() {
+	if s.limits.connections != nil && s.OverloadPolicy == OverloadBackpressure {
+		s.limits.connections <- struct{}{}
+	}
+}
+
+// trackConnection accounts for a freshly accepted connection. It returns nil
+// if the connection was rejected, in which case it has already been answered
+// and closed.
+func (s *Server) trackConnection(conn net.Conn) net.Conn {
+	s.limits.totalConnections.Add(1)
+
+	if s.limits.connections != nil && s.OverloadPolicy != OverloadBackpressure {
+		select {
+		case s.limits.connections <- struct{}{}:
+		default:
+			s.limits.rejectedConnections.Add(1)
+			s.rejectOverloaded(conn)
+			return nil
+		}
+	}
+
+	s.limits.activeConnections.Add(1)
+	return &trackedConn{Conn: conn, server: s}
+}
+
+// trackPeer enforces MaxConnectionsPerIP once the real peer address is known,
+// i.e. after any PROXY protocol header has been read.
+func (s *Server) trackPeer(conn net.Conn) bool {
+	if s.limits.perIP == nil {
+		return true
+	}
+
+	tc, ok := conn.(*trackedConn)
+	if !ok {
+		if pc, isProxy := conn.(*proxyConn); isProxy {
+			tc, ok = pc.Conn.(*trackedConn)
+		}
+	}
+	if !ok {
+		return true
+	}
+
+	ip := conn.RemoteAddr().String()
+	if parsed := parseHostIP(ip); parsed != nil {
+		ip = parsed.String()
+	}
+
+	s.limits.perIPMu.Lock()
+	if s.limits.perIP[ip] >= *s.MaxConnectionsPerIP {
+		s.limits.perIPMu.Unlock()
+		s.limits.rejectedConnections.Add(1)
+		return false
+	}
+	s.limits.perIP[ip]++
+	s.limits.perIPMu.Unlock()
+
+	tc.peer = ip
+	return true
+}
+
+// acquireRequestSlot enforces MaxConcurrentRequests. The returned function
+// releases the slot; it is nil if the request was rejected.
+func (s *Server) acquireRequestSlot() func() {
+	s.limits.totalRequests.Add(1)
+
+	if s.limits.requests != nil {
+		if s.OverloadPolicy == OverloadBackpressure {
+			s.limits.requests <- struct{}{}
+		} else {
+			select {
+			case s.limits.requests <- struct{}{}:
+			default:
+				s.limits.rejectedRequests.Add(1)
+				return nil
+			}
+		}
+	}
+
+	s.limits.activeRequests.Add(1)
+	return func() {
+		s.limits.activeRequests.Add(-1)
+		if s.limits.requests != nil {
+			<-s.limits.requests
+		}
+	}
+}
+
+func (s *Server) rejectOverloaded(conn net.Conn) {
+	if s.tlsConfig != nil {
+		// No handshake has happened yet, so there is nobody to talk HTTP to.
+		conn.Close()
+		return
+	}
+
+	res := &Response{
+		Server:  s,
+		conn:    conn,
+		Headers: ResponseHeaders{},
+	}
+	s.overloaded(res)
+	res.Done()
+}
+
+func (s *Server) overloaded(res *Response) {
+	retryAfter := time.Second
+	if s.RetryAfter != nil && *s.RetryAfter > 0 {
+		retryAfter = *s.RetryAfter
+	}
+	res.Headers.Add("Retry-After", strconv.Itoa(int((retryAfter+time.Second-1)/time.Second)))
+	res.ApiError(503, "Server is overloaded.")
+}
+
+type trackedConn struct {
+	net.Conn
+	server *Server
+	peer   string
+	once   sync.Once
+}
+
+// ReadFrom keeps sendfile/splice available to io.Copy through the wrapper.
+func (c *trackedConn) ReadFrom(r io.Reader) (int64, error) {
+	if rf, ok := c.Conn.(io.ReaderFrom); ok {
+		return rf.ReadFrom(r)
+	}
+	return io.Copy(struct{ io.Writer }{c.Conn}, r)
+}
+
+func (c *trackedConn) Close() error {
+	err := c.Conn.Close()
+	c.once.Do(func() {
+		limits := &c.server.limits
+		limits.activeConnections.Add(-1)
+		if limits.connections != nil {
+			<-limits.connections
+		}
+		if c.peer != "" {
+			limits.perIPMu.Lock()
+			if limits.perIP[c.peer] <= 1 {
+				delete(limits.perIP, c.peer)
+			} else {
+				limits.perIP[c.peer]--
+			}
+			limits.perIPMu.Unlock()
+		}
+	})
+	return err
+}
@@ -0,0 +1,161 @@
+package gonanoweb
+
+import (
+	"path"
+	"strings"
+)
+
+type TrailingSlashPolicy int
+
+const (
+	TrailingSlashLenient  TrailingSlashPolicy = iota // "/users/" and "/users" both match
+	TrailingSlashStrict                              // The trailing slash must match the route
+	TrailingSlashRedirect                            // Redirect to the form the route was registered with
+)
+
+// PathOptions controls how request paths are matched against routes. Without
+// PathOptions empty segments are ignored, so "/users//1/" matches
+// "/users/:id"; with PathOptions every segment counts and the policies below
+// decide what happens to non-canonical paths.
+type PathOptions struct {
+	TrailingSlash   TrailingSlashPolicy
+	CaseInsensitive bool // Match static segments case-insensitively
+	CleanPath       bool // Redirect paths with duplicate slashes, "." or ".." segments to their clean form
+	RedirectCode    int  // 301 or 308; defaults to 301 for GET/HEAD and 308 otherwise
+}
+
+// canonicalPath returns the clean form of the request path if CleanPath is
+// enabled and the path is not already clean, or "" otherwise.
+func (s *Server) canonicalPath(req *Request) string {
+	if s.PathOptions == nil || !s.PathOptions.CleanPath {
+		return ""
+	}
+	if clean := cleanPath(req.Path); clean != req.Path {
+		return clean
+	}
+	return ""
+}
+
+// trailingSlashRedirect returns the request path with its trailing slash
+// toggled if the redirect policy is enabled and that path matches a route.
+func (s *Server) trailingSlashRedirect(req *Request) string {
+	if s.PathOptions == nil || s.PathOptions.TrailingSlash != TrailingSlashRedirect || req.Path == "/" {
+		return ""
+	}
+
+	original := req.Path
+	alternative := original + "/"
+	if strings.HasSuffix(original, "/") {
+		alternative = strings.TrimSuffix(original, "/")
+	}
+
+	req.Path = alternative
+	_, found := s.findRoute(req, nil)
+	req.Path = original
+
+	if found {
+		return alternative
+	}
+	return ""
+}
+
+func (s *Server) redirectCode(method string) int {
+	if s.PathOptions != nil && s.PathOptions.RedirectCode != 0 {
+		return s.PathOptions.RedirectCode
+	}
+	if method == "GET" || method == "HEAD" {
+		return 301
+	}
+	return 308
+}
+
+// cleanPath resolves "." and ".." segments and collapses duplicate slashes,
+// keeping a trailing slash if there was one.
+func cleanPath(p string) string {
+	if p == "" {
+		return "/"
+	}
+	clean := path.Clean("/" + p)
+	if strings.HasSuffix(p, "/") && clean != "/" {
+		clean += "/"
+	}
+	return clean
+}
+
+// routeHasTrailingSlash reports whether a route was registered with a
+// trailing slash. A route registered as "/" inside a router does not add one
+// to the router's prefix.
+func routeHasTrailingSlash(routePath string) bool {
+	return len(routePath) > 1 && strings.HasSuffix(routePath, "/")
+}
+
+// matchPathStrict is the PathOptions counterpart of matchPath: empty segments
+// in the request path never match, and the trailing slash is compared
+// according to the policy.
+func matchPathStrict(pattern string, trailingSlash bool, path string, opts *PathOptions) (map[string]string, bool) {
+	if !strings.HasPrefix(path, "/") {
+		return nil, false
+	}
+	path = path[1:]
+
+	// A wildcard captures the trailing slash itself, so the policy does not
+	// apply to it.
+	wildcard := strings.Contains(pattern, "/*")
+
+	pathTrailingSlash := strings.HasSuffix(path, "/")
+	if pathTrailingSlash {
+		path = path[:len(path)-1]
+	}
+	if !wildcard && opts.TrailingSlash != TrailingSlashLenient && trailingSlash != pathTrailingSlash {
+		return nil, false
+	}
+
+	var params map[string]string
+	pathDone := path == ""
+	for {
+		var routePart string
+		routePart, pattern = nextSegment(pattern)
+
+		if strings.HasPrefix(routePart, "*") {
+			if params == nil {
+				params = make(map[string]string)
+			}
+			rest := ""
+			if !pathDone {
+				rest = path
+				if pathTrailingSlash {
+					rest += "/"
+				}
+			}
+			params[routePart[1:]] = rest
+			return params, true
+		}
+
+		if pathDone || routePart == "" {
+			if !pathDone || routePart != "" {
+				return nil, false
+			}
+			break
+		}
+
+		pathPart, rest, more := strings.Cut(path, "/")
+		path, pathDone = rest, !more
+		if pathPart == "" {
+			return nil, false
+		}
+
+		if strings.HasPrefix(routePart, ":") {
+			if params == nil {
+				params = make(map[string]string)
+			}
+			params[routePart[1:]] = pathPart
+		} else if routePart != pathPart && !(opts.CaseInsensitive && strings.EqualFold(routePart, pathPart)) {
+			return nil, false
+		}
+	}
+
+	if params == nil {
+		params = make(map[string]string)
+	}
+	return params, true
+}
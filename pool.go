@@ -0,0 +1,95 @@
+package gonanoweb
+
+import (
+	"bufio"
+	"io"
+	"sync"
+)
+
+// Requests, responses and their buffers are recycled between connections to
+// keep per-request allocations low. Handlers must not retain *Request or
+// *Response (or req.Headers, req.Params, ...) after they return.
+var (
+	requestPool = sync.Pool{
+		New: func() interface{} {
+			return &Request{
+				Headers:     make(map[string]string, 16),
+				QueryParams: make(map[string][]string),
+				data:        make(map[string]interface{}),
+			}
+		},
+	}
+
+	responsePool = sync.Pool{
+		New: func() interface{} {
+			return &Response{
+				Headers: ResponseHeaders{Values: make([]string, 0, 8)},
+			}
+		},
+	}
+
+	readerPool = sync.Pool{
+		New: func() interface{} {
+			return bufio.NewReaderSize(nil, 4096)
+		},
+	}
+
+	writeBufferPool = sync.Pool{
+		New: func() interface{} {
+			b := make([]byte, 0, 4096)
+			return &b
+		},
+	}
+)
+
+func acquireRequest(s *Server) *Request {
+	req := requestPool.Get().(*Request)
+	req.server = s
+	req.MaxRequestSize = s.MaxRequestSize
+	return req
+}
+
+func releaseRequest(req *Request) {
+	req.removeTempFiles()
+	if req.reader != nil {
+		req.reader.Reset(nil)
+		readerPool.Put(req.reader)
+	}
+
+	clear(req.Headers)
+	clear(req.QueryParams)
+	clear(req.data)
+	clear(req.chain)
+	clear(req.routers)
+	*req = Request{
+		Headers:     req.Headers,
+		QueryParams: req.QueryParams,
+		data:        req.data,
+		chain:       req.chain[:0],
+		routers:     req.routers[:0],
+		tempFiles:   req.tempFiles,
+	}
+	requestPool.Put(req)
+}
+
+func acquireReader(r io.Reader) *bufio.Reader {
+	reader := readerPool.Get().(*bufio.Reader)
+	reader.Reset(r)
+	return reader
+}
+
+func acquireResponse(s *Server) *Response {
+	res := responsePool.Get().(*Response)
+	res.Server = s
+	res.Status = 200
+	res.Body = []byte{}
+	return res
+}
+
+func releaseResponse(res *Response) {
+	clear(res.Headers.Values)
+	*res = Response{
+		Headers: ResponseHeaders{Values: res.Headers.Values[:0]},
+	}
+	responsePool.Put(res)
+}
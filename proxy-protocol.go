@@ -0,0 +1,326 @@
+package gonanoweb
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+)
+
+type ProxyProtocolPolicy int
+
+const (
+	ProxyProtocolUse     ProxyProtocolPolicy = iota // Parse the header if present
+	ProxyProtocolRequire                            // Drop connections without a header
+	ProxyProtocolIgnore                             // Never parse, pass bytes through untouched
+	ProxyProtocolReject                             // Drop connections that send a header
+)
+
+type ProxyProtocolOptions struct {
+	Policy           ProxyProtocolPolicy // Policy applied to allowed upstreams
+	AllowedUpstreams []string            // CIDRs or IPs allowed to send a header, empty trusts no one
+	allowed          []*net.IPNet
+}
+
+// ProxyTLV is a type-length-value extension carried in a PROXY v2 header.
+type ProxyTLV struct {
+	Type  byte
+	Value []byte
+}
+
+const (
+	ProxyTLVTypeALPN      byte = 0x01
+	ProxyTLVTypeAuthority byte = 0x02
+	ProxyTLVTypeCRC32C    byte = 0x03
+	ProxyTLVTypeNoop      byte = 0x04
+	ProxyTLVTypeUniqueID  byte = 0x05
+	ProxyTLVTypeSSL       byte = 0x20
+	ProxyTLVTypeNetNS     byte = 0x30
+)
+
+// ProxyHeader is the decoded PROXY protocol header of a connection.
+type ProxyHeader struct {
+	Version         int
+	Local           bool // v2 LOCAL command or v1 UNKNOWN: addresses are the real peer's
+	SourceAddr      net.Addr
+	DestinationAddr net.Addr
+	TLVs            []ProxyTLV
+}
+
+var proxyV2Signature = []byte("\r\n\r\n\x00\r\nQUIT\n")
+
+var errProxyHeaderRequired = errors.New("proxy protocol header required")
+
+type proxyConn struct {
+	net.Conn
+	reader *bufio.Reader
+	header *ProxyHeader
+}
+
+func (c *proxyConn) Read(b []byte) (int, error) {
+	return c.reader.Read(b)
+}
+
+func (c *proxyConn) ReadFrom(r io.Reader) (int64, error) {
+	if rf, ok := c.Conn.(io.ReaderFrom); ok {
+		return rf.ReadFrom(r)
+	}
+	return io.Copy(struct{ io.Writer }{c.Conn}, r)
+}
+
+func (c *proxyConn) RemoteAddr() net.Addr {
+	if c.header != nil && !c.header.Local && c.header.SourceAddr != nil {
+		return c.header.SourceAddr
+	}
+	return c.Conn.RemoteAddr()
+}
+
+func (c *proxyConn) LocalAddr() net.Addr {
+	if c.header != nil && !c.header.Local && c.header.DestinationAddr != nil {
+		return c.header.DestinationAddr
+	}
+	return c.Conn.LocalAddr()
+}
+
+// policyFor returns the policy for a peer. Peers outside AllowedUpstreams
+// are never allowed to send a header, otherwise any client could spoof its
+// address.
+func (o *ProxyProtocolOptions) policyFor(addr net.Addr) ProxyProtocolPolicy {
+	if o.Policy == ProxyProtocolIgnore {
+		return o.Policy
+	}
+
+	ip := parseHostIP(addr.String())
+	for _, network := range o.allowed {
+		if ip != nil && network.Contains(ip) {
+			return o.Policy
+		}
+	}
+	return ProxyProtocolReject
+}
+
+// acceptProxyHeader reads the PROXY protocol header (if any) from a freshly
+// accepted connection and returns a connection reporting the real peer.
+func (s *Server) acceptProxyHeader(conn net.Conn) (net.Conn, error) {
+	policy := s.ProxyProtocol.policyFor(conn.RemoteAddr())
+	if policy == ProxyProtocolIgnore {
+		return conn, nil
+	}
+
+	pc := &proxyConn{Conn: conn, reader: bufio.NewReader(conn)}
+	header, err := readProxyHeader(pc.reader)
+	if err != nil {
+		return nil, err
+	}
+
+	switch {
+	case header == nil && policy == ProxyProtocolRequire:
+		return nil, errProxyHeaderRequired
+	case header != nil && policy == ProxyProtocolReject:
+		return nil, fmt.Errorf("proxy protocol header not allowed from %s", conn.RemoteAddr())
+	}
+
+	pc.header = header
+	return pc, nil
+}
+
+// readProxyHeader returns nil without consuming anything when the connection
+// does not start with a PROXY header.
+func readProxyHeader(r *bufio.Reader) (*ProxyHeader, error) {
+	first, err := r.Peek(1)
+	if err != nil {
+		return nil, err
+	}
+
+	switch first[0] {
+	case 'P':
+		prefix, err := r.Peek(6)
+		if err != nil || string(prefix) != "PROXY " {
+			return nil, nil
+		}
+		return readProxyHeaderV1(r)
+	case '\r':
+		prefix, err := r.Peek(len(proxyV2Signature))
+		if err != nil || !bytes.Equal(prefix, proxyV2Signature) {
+			return nil, nil
+		}
+		return readProxyHeaderV2(r)
+	}
+	return nil, nil
+}
+
+func readProxyHeaderV1(r *bufio.Reader) (*ProxyHeader, error) {
+	// The v1 header is at most 107 bytes including the trailing CRLF.
+	var line []byte
+	for len(line) < 107 {
+		b, err := r.ReadByte()
+		if err != nil {
+			return nil, err
+		}
+		line = append(line, b)
+		if b == '\n' {
+			break
+		}
+	}
+	if !bytes.HasSuffix(line, []byte("\r\n")) {
+		return nil, errors.New("proxy v1: header not terminated by CRLF")
+	}
+
+	fields := strings.Split(string(line[:len(line)-2]), " ")
+	if len(fields) < 2 {
+		return nil, errors.New("proxy v1: malformed header")
+	}
+
+	header := &ProxyHeader{Version: 1}
+	switch fields[1] {
+	case "UNKNOWN":
+		header.Local = true
+		return header, nil
+	case "TCP4", "TCP6":
+	default:
+		return nil, fmt.Errorf("proxy v1: unsupported protocol %q", fields[1])
+	}
+
+	if len(fields) != 6 {
+		return nil, errors.New("proxy v1: malformed header")
+	}
+
+	src := net.ParseIP(fields[2])
+	dst := net.ParseIP(fields[3])
+	if src == nil || dst == nil || (fields[1] == "TCP4") != (src.To4() != nil) || (fields[1] == "TCP4") != (dst.To4() != nil) {
+		return nil, errors.New("proxy v1: invalid address")
+	}
+
+	srcPort, err := parseProxyPort(fields[4])
+	if err != nil {
+		return nil, err
+	}
+	dstPort, err := parseProxyPort(fields[5])
+	if err != nil {
+		return nil, err
+	}
+
+	header.SourceAddr = &net.TCPAddr{IP: src, Port: srcPort}
+	header.DestinationAddr = &net.TCPAddr{IP: dst, Port: dstPort}
+	return header, nil
+}
+
+func parseProxyPort(value string) (int, error) {
+	port, err := strconv.Atoi(value)
+	if err != nil || port < 0 || port > 65535 || (len(value) > 1 && value[0] == '0') {
+		return 0, fmt.Errorf("proxy v1: invalid port %q", value)
+	}
+	return port, nil
+}
+
+func readProxyHeaderV2(r *bufio.Reader) (*ProxyHeader, error) {
+	fixed := make([]byte, 16)
+	if _, err := io.ReadFull(r, fixed); err != nil {
+		return nil, err
+	}
+
+	if fixed[12]>>4 != 2 {
+		return nil, fmt.Errorf("proxy v2: unsupported version %d", fixed[12]>>4)
+	}
+
+	payload := make([]byte, binary.BigEndian.Uint16(fixed[14:16]))
+	if _, err := io.ReadFull(r, payload); err != nil {
+		return nil, err
+	}
+
+	header := &ProxyHeader{Version: 2}
+	switch fixed[12] & 0x0f {
+	case 0x0:
+		header.Local = true
+	case 0x1:
+	default:
+		return nil, fmt.Errorf("proxy v2: unsupported command %d", fixed[12]&0x0f)
+	}
+
+	var addrLen int
+	family, transport := fixed[13]>>4, fixed[13]&0x0f
+	switch family {
+	case 0x1:
+		addrLen = 12
+	case 0x2:
+		addrLen = 36
+	case 0x3:
+		addrLen = 216
+	case 0x0:
+		header.Local = true
+	default:
+		return nil, fmt.Errorf("proxy v2: unsupported address family %d", family)
+	}
+
+	if len(payload) < addrLen {
+		return nil, errors.New("proxy v2: truncated address block")
+	}
+
+	if !header.Local {
+		switch family {
+		case 0x1, 0x2:
+			ipLen := (addrLen - 4) / 2
+			src := net.IP(append([]byte{}, payload[:ipLen]...))
+			dst := net.IP(append([]byte{}, payload[ipLen:2*ipLen]...))
+			srcPort := int(binary.BigEndian.Uint16(payload[2*ipLen:]))
+			dstPort := int(binary.BigEndian.Uint16(payload[2*ipLen+2:]))
+			if transport == 0x2 {
+				header.SourceAddr = &net.UDPAddr{IP: src, Port: srcPort}
+				header.DestinationAddr = &net.UDPAddr{IP: dst, Port: dstPort}
+			} else {
+				header.SourceAddr = &net.TCPAddr{IP: src, Port: srcPort}
+				header.DestinationAddr = &net.TCPAddr{IP: dst, Port: dstPort}
+			}
+		case 0x3:
+			header.SourceAddr = &net.UnixAddr{Name: string(bytes.TrimRight(payload[:108], "\x00")), Net: "unix"}
+			header.DestinationAddr = &net.UnixAddr{Name: string(bytes.TrimRight(payload[108:216], "\x00")), Net: "unix"}
+		}
+	}
+
+	tlvs, err := parseProxyTLVs(payload[addrLen:])
+	if err != nil {
+		return nil, err
+	}
+	header.TLVs = tlvs
+	return header, nil
+}
+
+func parseProxyTLVs(data []byte) ([]ProxyTLV, error) {
+	var tlvs []ProxyTLV
+	for len(data) > 0 {
+		if len(data) < 3 {
+			return nil, errors.New("proxy v2: truncated TLV")
+		}
+		length := int(binary.BigEndian.Uint16(data[1:3]))
+		if len(data) < 3+length {
+			return nil, errors.New("proxy v2: truncated TLV")
+		}
+		tlvs = append(tlvs, ProxyTLV{Type: data[0], Value: data[3 : 3+length]})
+		data = data[3+length:]
+	}
+	return tlvs, nil
+}
+
+// TLV returns the value of the first TLV with the given type.
+func (h *ProxyHeader) TLV(t byte) ([]byte, bool) {
+	if h == nil {
+		return nil, false
+	}
+	for _, tlv := range h.TLVs {
+		if tlv.Type == t {
+			return tlv.Value, true
+		}
+	}
+	return nil, false
+}
+
+// ProxyHeader returns the PROXY protocol header received on the connection,
+// or nil when none was sent.
+func (r *Request) ProxyHeader() *ProxyHeader {
+	return r.proxyHeader
+}
@@ -0,0 +1,131 @@
+package gonanoweb
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"io"
+	"net"
+	"strings"
+	"testing"
+)
+
+func proxyV2(command, family byte, payload []byte) []byte {
+	header := append([]byte{}, proxyV2Signature...)
+	header = append(header, 0x20|command, family)
+	header = binary.BigEndian.AppendUint16(header, uint16(len(payload)))
+	return append(header, payload...)
+}
+
+func proxyV2IPv4(tlvs ...byte) []byte {
+	payload := []byte{192, 0, 2, 1, 198, 51, 100, 7, 0x30, 0x39, 0x01, 0xbb}
+	return append(payload, tlvs...)
+}
+
+func TestReadProxyHeader(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   []byte
+		wantErr bool
+		want    *ProxyHeader // nil means no header
+		source  string
+	}{
+		{name: "v1 tcp4", input: []byte("PROXY TCP4 192.0.2.1 198.51.100.7 12345 443\r\n"), want: &ProxyHeader{Version: 1}, source: "192.0.2.1:12345"},
+		{name: "v1 tcp6", input: []byte("PROXY TCP6 2001:db8::1 2001:db8::2 1 2\r\n"), want: &ProxyHeader{Version: 1}, source: "[2001:db8::1]:1"},
+		{name: "v1 unknown", input: []byte("PROXY UNKNOWN\r\n"), want: &ProxyHeader{Version: 1, Local: true}},
+		{name: "v1 missing CRLF", input: []byte("PROXY TCP4 192.0.2.1 198.51.100.7 12345 443\n"), wantErr: true},
+		{name: "v1 truncated", input: []byte("PROXY TCP4 192.0.2.1"), wantErr: true},
+		{name: "v1 too long", input: []byte("PROXY TCP4 " + strings.Repeat("1", 120) + "\r\n"), wantErr: true},
+		{name: "v1 leading zero port", input: []byte("PROXY TCP4 192.0.2.1 198.51.100.7 080 443\r\n"), wantErr: true},
+		{name: "v1 port out of range", input: []byte("PROXY TCP4 192.0.2.1 198.51.100.7 65536 443\r\n"), wantErr: true},
+		{name: "v1 family mismatch", input: []byte("PROXY TCP4 2001:db8::1 198.51.100.7 1 2\r\n"), wantErr: true},
+		{name: "v1 missing fields", input: []byte("PROXY TCP4 192.0.2.1 198.51.100.7 1\r\n"), wantErr: true},
+		{name: "v1 unsupported protocol", input: []byte("PROXY UDP4 192.0.2.1 198.51.100.7 1 2\r\n"), wantErr: true},
+		{name: "v2 tcp4", input: proxyV2(0x1, 0x11, proxyV2IPv4()), want: &ProxyHeader{Version: 2}, source: "192.0.2.1:12345"},
+		{name: "v2 tcp4 with TLV", input: proxyV2(0x1, 0x11, proxyV2IPv4(ProxyTLVTypeAuthority, 0, 3, 'a', 'b', 'c')), want: &ProxyHeader{Version: 2, TLVs: []ProxyTLV{{Type: ProxyTLVTypeAuthority, Value: []byte("abc")}}}, source: "192.0.2.1:12345"},
+		{name: "v2 local", input: proxyV2(0x0, 0x00, nil), want: &ProxyHeader{Version: 2, Local: true}},
+		{name: "v2 truncated fixed header", input: proxyV2(0x1, 0x11, nil)[:14], wantErr: true},
+		{name: "v2 truncated payload", input: proxyV2(0x1, 0x11, proxyV2IPv4())[:20], wantErr: true},
+		{name: "v2 short address block", input: proxyV2(0x1, 0x11, proxyV2IPv4()[:8]), wantErr: true},
+		{name: "v2 short unix address block", input: proxyV2(0x1, 0x31, make([]byte, 100)), wantErr: true},
+		{name: "v2 truncated TLV header", input: proxyV2(0x1, 0x11, proxyV2IPv4(ProxyTLVTypeNoop, 0)), wantErr: true},
+		{name: "v2 truncated TLV value", input: proxyV2(0x1, 0x11, proxyV2IPv4(ProxyTLVTypeNoop, 0, 5, 'x')), wantErr: true},
+		{name: "v2 bad version", input: append(append([]byte{}, proxyV2Signature...), 0x11, 0x11, 0, 0), wantErr: true},
+		{name: "v2 bad command", input: proxyV2(0x2, 0x11, proxyV2IPv4()), wantErr: true},
+		{name: "v2 bad family", input: proxyV2(0x1, 0x41, proxyV2IPv4()), wantErr: true},
+		{name: "plain http", input: []byte("GET / HTTP/1.1\r\n\r\n")},
+		{name: "http starting with P", input: []byte("POST / HTTP/1.1\r\n\r\n")},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			reader := bufio.NewReader(bytes.NewReader(tt.input))
+			header, err := readProxyHeader(reader)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("expected an error, got header %+v", header)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if tt.want == nil {
+				if header != nil {
+					t.Fatalf("expected no header, got %+v", header)
+				}
+				rest, _ := io.ReadAll(reader)
+				if !bytes.Equal(rest, tt.input) {
+					t.Fatalf("input was consumed: %q left", rest)
+				}
+				return
+			}
+
+			if header == nil {
+				t.Fatal("expected a header, got nil")
+			}
+			if header.Version != tt.want.Version || header.Local != tt.want.Local {
+				t.Errorf("got version %d local %v, want version %d local %v", header.Version, header.Local, tt.want.Version, tt.want.Local)
+			}
+			if tt.source != "" && (header.SourceAddr == nil || header.SourceAddr.String() != tt.source) {
+				t.Errorf("got source %v, want %s", header.SourceAddr, tt.source)
+			}
+			if len(header.TLVs) != len(tt.want.TLVs) {
+				t.Fatalf("got %d TLVs, want %d", len(header.TLVs), len(tt.want.TLVs))
+			}
+			for i, tlv := range tt.want.TLVs {
+				if header.TLVs[i].Type != tlv.Type || !bytes.Equal(header.TLVs[i].Value, tlv.Value) {
+					t.Errorf("TLV %d: got %+v, want %+v", i, header.TLVs[i], tlv)
+				}
+			}
+		})
+	}
+}
+
+func TestProxyProtocolPolicyFor(t *testing.T) {
+	peer := &net.TCPAddr{IP: net.ParseIP("10.0.0.5"), Port: 1234}
+
+	tests := []struct {
+		name     string
+		options  ProxyProtocolOptions
+		upstream []string
+		want     ProxyProtocolPolicy
+	}{
+		{name: "zero value trusts no one", want: ProxyProtocolReject},
+		{name: "require without upstreams", options: ProxyProtocolOptions{Policy: ProxyProtocolRequire}, want: ProxyProtocolReject},
+		{name: "allowed network", upstream: []string{"10.0.0.0/8"}, want: ProxyProtocolUse},
+		{name: "allowed ip", options: ProxyProtocolOptions{Policy: ProxyProtocolRequire}, upstream: []string{"10.0.0.5"}, want: ProxyProtocolRequire},
+		{name: "other network", upstream: []string{"192.168.0.0/16"}, want: ProxyProtocolReject},
+		{name: "ignore", options: ProxyProtocolOptions{Policy: ProxyProtocolIgnore}, want: ProxyProtocolIgnore},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.options.allowed = parseTrustedProxies(tt.upstream)
+			if got := tt.options.policyFor(peer); got != tt.want {
+				t.Errorf("got policy %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
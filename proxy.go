@@ -0,0 +1,252 @@
+package gonanoweb
+
+import (
+	"crypto/tls"
+	"log"
+	"net"
+	"strings"
+)
+
+// parseTrustedProxies converts a list of CIDRs or bare IP addresses into
+// networks. Invalid entries are a configuration error and panic, the same way
+// invalid route paths do.
+func parseTrustedProxies(proxies []string) []*net.IPNet {
+	networks := make([]*net.IPNet, 0, len(proxies))
+	for _, p := range proxies {
+		p = strings.TrimSpace(p)
+		if !strings.Contains(p, "/") {
+			ip := net.ParseIP(p)
+			if ip == nil {
+				log.Panicf("invalid trusted proxy %q", p)
+			}
+			bits := 128
+			if ip.To4() != nil {
+				ip = ip.To4()
+				bits = 32
+			}
+			networks = append(networks, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+
+		_, network, err := net.ParseCIDR(p)
+		if err != nil {
+			log.Panicf("invalid trusted proxy %q: %v", p, err)
+		}
+		networks = append(networks, network)
+	}
+	return networks
+}
+
+func (s *Server) isTrustedProxy(ip net.IP) bool {
+	if s == nil || ip == nil {
+		return false
+	}
+	for _, network := range s.TrustedProxies {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// remoteIP returns the IP address of the directly connected peer.
+func (r *Request) remoteIP() net.IP {
+	if r.conn == nil || *r.conn == nil {
+		return nil
+	}
+	addr := (*r.conn).RemoteAddr()
+	if addr == nil {
+		return nil
+	}
+	return parseHostIP(addr.String())
+}
+
+// fromTrustedProxy reports whether the directly connected peer is allowed to
+// set forwarding headers.
+func (r *Request) fromTrustedProxy() bool {
+	return r.server.isTrustedProxy(r.remoteIP())
+}
+
+// ClientIP returns the IP address of the client that originated the request.
+// Forwarded, X-Forwarded-For and X-Real-IP are only honored when the request
+// arrives through a trusted proxy, in which case the chain is walked from the
+// nearest hop outwards and the first untrusted address wins.
+func (r *Request) ClientIP() string {
+	remote := r.remoteIP()
+	if remote == nil {
+		return ""
+	}
+	if !r.fromTrustedProxy() {
+		return remote.String()
+	}
+
+	hops := forwardedValues(r.Headers["forwarded"], "for")
+	if len(hops) == 0 {
+		for _, hop := range strings.Split(r.Headers["x-forwarded-for"], ",") {
+			if hop = strings.TrimSpace(hop); hop != "" {
+				hops = append(hops, hop)
+			}
+		}
+	}
+
+	if len(hops) == 0 {
+		if ip := parseHostIP(strings.TrimSpace(r.Headers["x-real-ip"])); ip != nil {
+			return ip.String()
+		}
+		return remote.String()
+	}
+
+	client := remote
+	for i := len(hops) - 1; i >= 0; i-- {
+		ip := parseHostIP(hops[i])
+		if ip == nil {
+			break
+		}
+		client = ip
+		if !r.server.isTrustedProxy(ip) {
+			break
+		}
+	}
+	return client.String()
+}
+
+// Scheme returns "https" or "http" as seen by the client. Forwarded and
+// X-Forwarded-Proto are only honored from trusted proxies, taking the value
+// recorded by the outermost proxy of the trusted chain.
+func (r *Request) Scheme() string {
+	if proto := r.forwardedParam("proto", "x-forwarded-proto"); proto != "" {
+		return strings.ToLower(proto)
+	}
+
+	if r.isTLS() {
+		return "https"
+	}
+	return "http"
+}
+
+// Host returns the host requested by the client, including the port if one
+// was sent. Forwarded and X-Forwarded-Host are only honored from trusted
+// proxies, the same way as in Scheme.
+func (r *Request) Host() string {
+	if host := r.forwardedParam("host", "x-forwarded-host"); host != "" {
+		return host
+	}
+	return r.Headers["host"]
+}
+
+// forwardedParam returns key from the Forwarded header, or else the
+// X-Forwarded-* header, walking the values from the nearest hop outwards like
+// ClientIP. Values left of the first untrusted hop may be spoofed and are
+// ignored.
+func (r *Request) forwardedParam(key string, header string) string {
+	if !r.fromTrustedProxy() {
+		return ""
+	}
+
+	if elements := forwardedElements(r.Headers["forwarded"]); len(elements) > 0 {
+		hops := make([]string, len(elements))
+		for i, element := range elements {
+			hops[i] = element["for"]
+		}
+
+		value := ""
+		for i := len(elements) - 1; i >= len(elements)-r.trustedHops(hops); i-- {
+			if v := elements[i][key]; v != "" {
+				value = v
+			}
+		}
+		if value != "" {
+			return value
+		}
+	}
+
+	var values []string
+	for _, value := range strings.Split(r.Headers[header], ",") {
+		if value = strings.TrimSpace(value); value != "" {
+			values = append(values, value)
+		}
+	}
+	if len(values) == 0 {
+		return ""
+	}
+	var hops []string
+	for _, hop := range strings.Split(r.Headers["x-forwarded-for"], ",") {
+		hops = append(hops, strings.TrimSpace(hop))
+	}
+	return values[max(len(values)-r.trustedHops(hops), 0)]
+}
+
+// trustedHops counts the proxies at the end of the chain that are trusted,
+// starting with the directly connected peer. hops holds the address each
+// proxy recorded for its own peer, in the order they were appended, so
+// hops[i] is the proxy that appended hops[i-1].
+func (r *Request) trustedHops(hops []string) int {
+	if !r.fromTrustedProxy() {
+		return 0
+	}
+	count := 1
+	for i := len(hops) - 1; i > 0; i-- {
+		if !r.server.isTrustedProxy(parseHostIP(hops[i])) {
+			break
+		}
+		count++
+	}
+	return count
+}
+
+func (r *Request) isTLS() bool {
+	if r.conn == nil {
+		return false
+	}
+	_, ok := (*r.conn).(*tls.Conn)
+	return ok
+}
+
+// forwardedValues extracts every value of the given parameter from an RFC 7239
+// Forwarded header, in the order the proxies appended them.
+func forwardedValues(header string, key string) []string {
+	var values []string
+	for _, element := range forwardedElements(header) {
+		if value := element[key]; value != "" {
+			values = append(values, value)
+		}
+	}
+	return values
+}
+
+// forwardedElements splits an RFC 7239 Forwarded header into one map of
+// lowercased parameters per proxy, in the order the proxies appended them.
+func forwardedElements(header string) []map[string]string {
+	if header == "" {
+		return nil
+	}
+
+	var elements []map[string]string
+	for _, element := range strings.Split(header, ",") {
+		params := map[string]string{}
+		for _, pair := range strings.Split(element, ";") {
+			kv := strings.SplitN(strings.TrimSpace(pair), "=", 2)
+			if len(kv) != 2 {
+				continue
+			}
+			params[strings.ToLower(kv[0])] = strings.Trim(strings.TrimSpace(kv[1]), "\"")
+		}
+		elements = append(elements, params)
+	}
+	return elements
+}
+
+// parseHostIP parses an IP address that may carry a port and IPv6 brackets,
+// e.g. "192.0.2.1", "192.0.2.1:4711", "[2001:db8::1]:4711" or "2001:db8::1".
+func parseHostIP(value string) net.IP {
+	if value == "" {
+		return nil
+	}
+	if ip := net.ParseIP(value); ip != nil {
+		return ip
+	}
+	if host, _, err := net.SplitHostPort(value); err == nil {
+		return net.ParseIP(host)
+	}
+	return net.ParseIP(strings.Trim(value, "[]"))
+}
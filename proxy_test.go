@@ -0,0 +1,115 @@
+package gonanoweb
+
+import (
+	"net"
+	"testing"
+)
+
+// peerConn is a testConn whose peer address can be chosen.
+type peerConn struct {
+	testConn
+	remote net.Addr
+}
+
+func (c *peerConn) RemoteAddr() net.Addr { return c.remote }
+
+func proxiedRequest(peer string, headers map[string]string) *Request {
+	s := NewServer(":0", &ServerOptions{TrustedProxies: []string{"10.0.0.0/8"}})
+	var conn net.Conn = &peerConn{remote: &net.TCPAddr{IP: net.ParseIP(peer), Port: 40000}}
+
+	req := NewRequest()
+	req.server = s
+	req.conn = &conn
+	req.Headers = headers
+	return req
+}
+
+func TestProxyHeaders(t *testing.T) {
+	tests := []struct {
+		name       string
+		peer       string
+		headers    map[string]string
+		wantIP     string
+		wantScheme string
+		wantHost   string
+	}{
+		{
+			name: "untrusted peer",
+			peer: "203.0.113.9",
+			headers: map[string]string{
+				"host":              "origin.internal",
+				"x-forwarded-for":   "198.51.100.1",
+				"x-forwarded-proto": "https",
+				"x-forwarded-host":  "example.com",
+				"forwarded":         "for=198.51.100.1;proto=https;host=example.com",
+			},
+			wantIP: "203.0.113.9", wantScheme: "http", wantHost: "origin.internal",
+		},
+		{
+			name: "trusted peer",
+			peer: "10.0.0.1",
+			headers: map[string]string{
+				"host":              "origin.internal",
+				"x-forwarded-for":   "198.51.100.1",
+				"x-forwarded-proto": "https",
+				"x-forwarded-host":  "example.com",
+			},
+			wantIP: "198.51.100.1", wantScheme: "https", wantHost: "example.com",
+		},
+		{
+			name: "trusted chain",
+			peer: "10.0.0.1",
+			headers: map[string]string{
+				"host":              "origin.internal",
+				"x-forwarded-for":   "198.51.100.1, 10.0.0.2",
+				"x-forwarded-proto": "https, http",
+				"x-forwarded-host":  "example.com, edge.internal",
+			},
+			wantIP: "198.51.100.1", wantScheme: "https", wantHost: "example.com",
+		},
+		{
+			name: "spoofed x-forwarded headers",
+			peer: "10.0.0.1",
+			headers: map[string]string{
+				"host":              "origin.internal",
+				"x-forwarded-for":   "10.9.9.9, 198.51.100.1",
+				"x-forwarded-proto": "https, http",
+				"x-forwarded-host":  "evil.com, example.com",
+			},
+			wantIP: "198.51.100.1", wantScheme: "http", wantHost: "example.com",
+		},
+		{
+			name: "forwarded from trusted peer",
+			peer: "10.0.0.1",
+			headers: map[string]string{
+				"host":      "origin.internal",
+				"forwarded": `for=198.51.100.1;proto=https;host=example.com, for="10.0.0.2";proto=http;host=edge.internal`,
+			},
+			wantIP: "198.51.100.1", wantScheme: "https", wantHost: "example.com",
+		},
+		{
+			name: "spoofed forwarded element",
+			peer: "10.0.0.1",
+			headers: map[string]string{
+				"host":      "origin.internal",
+				"forwarded": "for=10.9.9.9;proto=https;host=evil.com, for=198.51.100.1;proto=http;host=example.com",
+			},
+			wantIP: "198.51.100.1", wantScheme: "http", wantHost: "example.com",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := proxiedRequest(tt.peer, tt.headers)
+			if got := req.ClientIP(); got != tt.wantIP {
+				t.Errorf("ClientIP() = %q, want %q", got, tt.wantIP)
+			}
+			if got := req.Scheme(); got != tt.wantScheme {
+				t.Errorf("Scheme() = %q, want %q", got, tt.wantScheme)
+			}
+			if got := req.Host(); got != tt.wantHost {
+				t.Errorf("Host() = %q, want %q", got, tt.wantHost)
+			}
+		})
+	}
+}
@@ -0,0 +1,5 @@
+//go:build race
+
+package gonanoweb
+
+const raceEnabled = true
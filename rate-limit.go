@@ -2,7 +2,6 @@ package gonanoweb
 
 import (
 	"errors"
-	"strings"
 	"sync"
 	"time"
 )
@@ -78,8 +77,7 @@ func (rl *RateLimiter) Stop() {
 func RateLimitMiddleware(limiter *RateLimiter) Middleware {
 	return Middleware{
 		Handler: func(res *Response, req *Request) error {
-			ip := strings.Split((*req.conn).RemoteAddr().String(), ":")[0]
-			if !limiter.Allow(ip) {
+			if !limiter.Allow(req.ClientIP()) {
 				res.ApiError(429, "Too Many Requests")
 				return errors.New("rate limit exceeded")
 			}
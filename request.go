@@ -9,9 +9,22 @@ import (
 	"mime"
 	"mime/multipart"
 	"net"
+	"os"
+	"strconv"
 	"strings"
 )
 
+// DefaultMaxHeaderBytes caps the request line and headers when
+// ServerOptions.MaxHeaderBytes is not set. Larger heads are answered with
+// 431 Request Header Fields Too Large.
+const DefaultMaxHeaderBytes = 1 << 20
+
+// defaultMaxRequestSize caps buffered bodies, and multipart streams without
+// a MaxTotalSize, when MaxRequestSize is not set.
+const defaultMaxRequestSize = 10 * 1024 * 1024
+
+var ErrHeaderTooLarge = errors.New("request header fields too large")
+
 type Request struct {
 	Method          string
 	Path            string
@@ -26,6 +39,17 @@ type Request struct {
 	conn            *net.Conn
 	server          *Server
 	MultipartReader *multipart.Reader
+	expectContinue  bool
+	continueSent    bool
+	proxyHeader     *ProxyHeader
+	chain           []IStackable
+	routers         []*Router
+	rawQuery        string
+	decompression   *DecompressionOptions
+	tempFiles       []*os.File
+	formOptions     *FormDataOptions
+	streamBody      bool
+	bodyStream      io.Reader
 }
 
 func NewRequest() *Request {
@@ -35,51 +59,90 @@ func NewRequest() *Request {
 }
 
 func (r *Request) parseRequest(conn net.Conn) error {
-	if r.MaxRequestSize != nil && *r.MaxRequestSize > 0 {
-		r.reader = bufio.NewReaderSize(io.LimitReader(conn, *r.MaxRequestSize), 4096)
-	} else {
-		r.reader = bufio.NewReader(conn)
-	}
+	// The head is bounded by MaxHeaderBytes; MaxRequestSize is checked
+	// against Content-Length in parseBody, once routing picked the limit.
+	r.reader = acquireReader(conn)
 
-	line, err := r.reader.ReadString('\n')
+	budget := r.maxHeaderBytes()
+	requestLine, err := r.readHeadLine(&budget)
 	if err != nil {
-		return nil
+		return err
 	}
-	line = strings.TrimSpace(line)
+	line := strings.TrimSpace(string(requestLine))
 
-	parts := strings.Split(line, " ")
-	if len(parts) < 3 {
+	method, rest, ok := strings.Cut(line, " ")
+	if !ok {
+		return fmt.Errorf("invalid request line")
+	}
+	fullPath, _, ok := strings.Cut(rest, " ")
+	if !ok {
 		return fmt.Errorf("invalid request line")
 	}
-	method := parts[0]
-	fullPath := parts[1]
 	path, queryString := splitPathAndQuery(fullPath)
-	queryParams := parseQueryParams(queryString)
-	headers := make(map[string]string)
+	r.rawQuery = queryString
+
+	if r.QueryParams == nil {
+		r.QueryParams = make(map[string][]string)
+	}
+	parseQueryParamsInto(r.QueryParams, queryString)
+
+	if r.Headers == nil {
+		r.Headers = make(map[string]string)
+	}
 	for {
-		line, err := r.reader.ReadString('\n')
+		line, err := r.readHeadLine(&budget)
 		if err != nil {
 			return err
 		}
-		line = strings.TrimSpace(line)
+		line = bytes.TrimSpace(line)
 
-		if line == "" {
+		if len(line) == 0 {
 			break
 		}
 
-		headerParts := strings.SplitN(line, ": ", 2)
-		if len(headerParts) == 2 {
-			headers[strings.ToLower(headerParts[0])] = headerParts[1]
+		if i := bytes.Index(line, []byte(": ")); i != -1 {
+			r.Headers[strings.ToLower(string(line[:i]))] = string(line[i+2:])
 		}
 	}
 
 	r.Method = method
 	r.Path = path
-	r.QueryParams = queryParams
-	r.Headers = headers
+	r.expectContinue = strings.EqualFold(r.Headers["expect"], "100-continue")
 	return nil
 }
 
+// readHeadLine reads one line of the request head. Lines longer than the
+// reader's buffer are accumulated in a separate slice; budget is the number
+// of bytes left for the whole head and ErrHeaderTooLarge is returned once it
+// runs out.
+func (r *Request) readHeadLine(budget *int) ([]byte, error) {
+	line, err := r.reader.ReadSlice('\n')
+	if err == bufio.ErrBufferFull {
+		long := append([]byte(nil), line...)
+		for err == bufio.ErrBufferFull && len(long) <= *budget {
+			line, err = r.reader.ReadSlice('\n')
+			long = append(long, line...)
+		}
+		line = long
+	}
+
+	*budget -= len(line)
+	if *budget < 0 {
+		return nil, ErrHeaderTooLarge
+	}
+	if err != nil {
+		return nil, err
+	}
+	return line, nil
+}
+
+func (r *Request) maxHeaderBytes() int {
+	if r.server != nil && r.server.MaxHeaderBytes != nil && *r.server.MaxHeaderBytes > 0 {
+		return *r.server.MaxHeaderBytes
+	}
+	return DefaultMaxHeaderBytes
+}
+
 func splitPathAndQuery(fullPath string) (string, string) {
 	if i := strings.Index(fullPath, "?"); i != -1 {
 		return fullPath[:i], fullPath[i+1:]
@@ -87,97 +150,207 @@ func splitPathAndQuery(fullPath string) (string, string) {
 	return fullPath, ""
 }
 
-func parseQueryParams(queryString string) map[string][]string {
-	qp := make(map[string][]string)
+func parseQueryParamsInto(qp map[string][]string, queryString string) {
+	for queryString != "" {
+		var pair string
+		pair, queryString, _ = strings.Cut(queryString, "&")
+		key, value, _ := strings.Cut(pair, "=")
 
-	if queryString == "" {
-		return qp
+		qp[key] = append(qp[key], value)
 	}
+}
 
-	pairs := strings.Split(queryString, "&")
-	for _, pair := range pairs {
-		kv := strings.SplitN(pair, "=", 2)
-		key := kv[0]
-		var value string
-		if len(kv) > 1 {
-			value = kv[1]
-		}
+// sendContinue writes the interim 100 Continue response for clients that sent
+// Expect: 100-continue. It is called lazily right before the body is read, so
+// middleware can still reject the request with a final status without the
+// client ever uploading the body.
+func (r *Request) sendContinue() error {
+	if !r.expectContinue || r.continueSent || r.conn == nil {
+		return nil
+	}
+	r.continueSent = true
+	_, err := (*r.conn).Write([]byte("HTTP/1.1 100 Continue\r\n\r\n"))
+	return err
+}
 
-		qp[key] = append(qp[key], value)
+// continueReader sends 100 Continue on the first read of the body.
+type continueReader struct {
+	req    *Request
+	reader io.Reader
+}
+
+func (c *continueReader) Read(p []byte) (int, error) {
+	if err := c.req.sendContinue(); err != nil {
+		return 0, err
 	}
+	return c.reader.Read(p)
+}
 
-	return qp
+func (r *Request) formDataOptions() *FormDataOptions {
+	if r.formOptions != nil {
+		return r.formOptions
+	}
+	if r.server == nil || r.server.FormDataOptions == nil {
+		defaultOptions := DefaultFormDataOptions()
+		return &defaultOptions
+	}
+	return r.server.FormDataOptions
 }
 
 func (r *Request) parseBody() error {
 	var body []byte
-	if length, ok := r.Headers["content-length"]; ok {
-		var contentLength int64
-		_, err := fmt.Sscanf(length, "%d", &contentLength)
-		if err != nil {
-			return fmt.Errorf("invalid content-length: %w", err)
-		}
+	r.Body = &body
 
-		if r.MaxRequestSize != nil && contentLength > *r.MaxRequestSize {
-			return fmt.Errorf("content length %d exceeds maximum allowed size %d", contentLength, *r.MaxRequestSize)
-		}
+	length, ok := r.Headers["content-length"]
+	if !ok {
+		return nil
+	}
 
-		if r.MaxRequestSize == nil && contentLength > 10*1024*1024 {
-			return fmt.Errorf("content length %d exceeds default maximum size", contentLength)
-		}
+	contentLength, err := strconv.ParseInt(strings.TrimSpace(length), 10, 64)
+	if err != nil {
+		return ApiError{StatusCode: 400, Message: "Invalid Content-Length."}.WithError(fmt.Errorf("invalid content-length: %w", err))
+	}
+	if contentLength < 0 {
+		return ApiError{StatusCode: 400, Message: "Invalid Content-Length."}.WithError(fmt.Errorf("negative content-length %d", contentLength))
+	}
+
+	if r.MaxRequestSize != nil && contentLength > *r.MaxRequestSize {
+		return ApiError{StatusCode: 413, Message: "Request body too large."}.WithError(fmt.Errorf("content length %d exceeds maximum allowed size %d", contentLength, *r.MaxRequestSize))
+	}
+
+	options := r.formDataOptions()
+	mediaType, params, _ := mime.ParseMediaType(r.Headers["content-type"])
+
+	// Multipart bodies are only parsed on routes using FormDataMiddleware,
+	// straight off the connection unless they have to be decompressed first.
+	multipartForm := mediaType == "multipart/form-data" && r.formOptions != nil
+	multipartStream := multipartForm && params["boundary"] != "" && !r.encodedBody()
+
+	// Streamed bodies are never held in memory, so raw streams only get
+	// explicit limits. Multipart streams are bounded by MaxTotalSize, which
+	// falls back to the default request size when neither limit is set.
+	streamed := r.streamBody || multipartStream
+	if r.MaxRequestSize == nil && contentLength > defaultMaxRequestSize && !streamed {
+		return ApiError{StatusCode: 413, Message: "Request body too large."}.WithError(fmt.Errorf("content length %d exceeds default maximum size", contentLength))
+	}
+
+	if contentLength > 2147483647 && !streamed {
+		return ApiError{StatusCode: 413, Message: "Request body too large."}.WithError(fmt.Errorf("content length too large"))
+	}
 
-		if contentLength > 2147483647 {
-			return fmt.Errorf("content length too large")
+	if contentLength <= 0 {
+		return nil
+	}
+
+	if r.streamBody {
+		r.bodyStream = &continueReader{req: r, reader: &bodyReader{reader: r.reader, remaining: contentLength}}
+		return nil
+	}
+
+	if multipartStream {
+		if r.MaxRequestSize == nil && options.MaxTotalSize == 0 {
+			limited := *options
+			limited.MaxTotalSize = defaultMaxRequestSize
+			options = &limited
 		}
 
-		if contentLength <= 0 {
-			body = []byte{}
-			r.Body = &body
+		reader := multipart.NewReader(&continueReader{req: r, reader: &bodyReader{reader: r.reader, remaining: contentLength}}, params["boundary"])
+		if options.StreamingParser {
+			// Handlers read the parts themselves, so the whole body is
+			// checked against the total limit up front.
+			if contentLength > options.MaxTotalSize && options.MaxTotalSize > 0 {
+				return ApiError{StatusCode: 413, Message: "Request body too large."}.WithError(fmt.Errorf("content length %d exceeds maximum total size %d", contentLength, options.MaxTotalSize))
+			}
+			r.MultipartReader = reader
 			return nil
 		}
 
-		body = make([]byte, contentLength)
-		n, err := io.ReadFull(r.reader, body)
-		if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		formData, err := r.parseEntireForm(reader, options)
+		if err != nil {
 			return err
 		}
+		r.FormData = formData
+		return nil
+	}
+
+	if err := r.sendContinue(); err != nil {
+		return err
+	}
 
-		if int64(n) < contentLength {
-			body = body[:n]
+	body = make([]byte, contentLength)
+	if _, err := io.ReadFull(r.reader, body); err != nil {
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			return errShortBody.WithError(err)
 		}
+		return err
 	}
 	r.Body = &body
 
-	contentType := r.Headers["content-type"]
-	if contentType != "" {
-		mediaType, params, err := mime.ParseMediaType(contentType)
-		if err == nil && strings.HasPrefix(mediaType, "multipart/form-data") {
-			boundary, ok := params["boundary"]
-			if ok {
-				var options *FormDataOptions
-				if r.server.FormDataOptions == nil {
-					defaultOptions := DefaultFormDataOptions()
-					options = &defaultOptions
-				} else {
-					options = r.server.FormDataOptions
-				}
-
-				bodyReader := bytes.NewReader(*r.Body)
-				reader := multipart.NewReader(bodyReader, boundary)
-
-				formData, err := parseEntireForm(reader, options)
-				if err != nil {
-					return err
-				}
-
-				r.FormData = formData
+	if r.decompression != nil {
+		if err := r.decompressBody(); err != nil {
+			return err
+		}
+	}
+
+	switch {
+	case multipartForm:
+		boundary, ok := params["boundary"]
+		if ok {
+			reader := multipart.NewReader(bytes.NewReader(*r.Body), boundary)
+			if options.StreamingParser {
+				r.MultipartReader = reader
+				return nil
 			}
+
+			formData, err := r.parseEntireForm(reader, options)
+			if err != nil {
+				return err
+			}
+
+			r.FormData = formData
+		}
+	case mediaType == "application/x-www-form-urlencoded":
+		formData, err := parseURLEncodedForm(*r.Body, options)
+		if err != nil {
+			return err
 		}
+
+		r.FormData = formData
 	}
 
 	return nil
 }
 
+var errShortBody = ApiError{StatusCode: 400, Message: "Request body shorter than Content-Length."}
+
+// bodyReader reads the Content-Length bytes of a streamed body, reporting a
+// connection that ends early as errShortBody rather than a clean EOF.
+type bodyReader struct {
+	reader    io.Reader
+	remaining int64
+}
+
+func (b *bodyReader) Read(p []byte) (int, error) {
+	if b.remaining <= 0 {
+		return 0, io.EOF
+	}
+	if int64(len(p)) > b.remaining {
+		p = p[:b.remaining]
+	}
+	n, err := b.reader.Read(p)
+	b.remaining -= int64(n)
+	if err == io.EOF && b.remaining > 0 {
+		err = errShortBody.WithError(io.ErrUnexpectedEOF)
+	}
+	return n, err
+}
+
+// encodedBody reports whether the body has a Content-Encoding that the
+// decompression middleware is going to undo.
+func (r *Request) encodedBody() bool {
+	return r.decompression != nil && len(contentCodings(r.Headers["content-encoding"])) > 0
+}
+
 func (r *Request) SetData(key string, data interface{}) error {
 	_, ok := r.data[key]
 	if ok {
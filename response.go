@@ -2,8 +2,9 @@ package gonanoweb
 
 import (
 	"encoding/json"
-	"fmt"
+	"io"
 	"net"
+	"strconv"
 	"strings"
 )
 
@@ -12,7 +13,37 @@ type ResponseHeaders struct {
 }
 
 func (h *ResponseHeaders) Add(key, value string) {
-	h.Values = append(h.Values, fmt.Sprintf("%s: %s", key, value))
+	h.Values = append(h.Values, key+": "+value)
+}
+
+// Get returns the value of the first header named key, compared
+// case-insensitively, or "" if there is none.
+func (h *ResponseHeaders) Get(key string) string {
+	for _, v := range h.Values {
+		if name, value, ok := strings.Cut(v, ": "); ok && strings.EqualFold(name, key) {
+			return value
+		}
+	}
+	return ""
+}
+
+// Set replaces all headers named key with a single value.
+func (h *ResponseHeaders) Set(key, value string) {
+	h.Del(key)
+	h.Add(key, value)
+}
+
+// Del removes all headers named key.
+func (h *ResponseHeaders) Del(key string) {
+	values := h.Values[:0]
+	for _, v := range h.Values {
+		if name, _, ok := strings.Cut(v, ": "); ok && strings.EqualFold(name, key) {
+			continue
+		}
+		values = append(values, v)
+	}
+	clear(h.Values[len(values):])
+	h.Values = values
 }
 
 type Response struct {
@@ -22,11 +53,35 @@ type Response struct {
 	Body        []byte
 	Headers     ResponseHeaders
 	EventStream *EventStream
+	omitBody    bool
+	bodyReader  io.Reader
+	bodyLength  int64
+	req         *Request
+	compression *compression
+}
+
+// setBodyReader makes Done stream length bytes from reader instead of sending
+// Body, or everything up to EOF without a Content-Length if length is
+// negative. The reader is closed after sending if it is an io.Closer.
+func (r *Response) setBodyReader(reader io.Reader, length int64) {
+	r.discardBodyReader()
+	r.Body = nil
+	r.bodyReader = reader
+	r.bodyLength = length
+}
+
+func (r *Response) discardBodyReader() {
+	if closer, ok := r.bodyReader.(io.Closer); ok {
+		closer.Close()
+	}
+	r.bodyReader = nil
+	r.bodyLength = 0
 }
 
 func (r *Response) ApiError(code int, message string) {
+	r.discardBodyReader()
 	r.Status = code
-	r.Headers.Add("content-type", "application/json")
+	r.Headers.Set("Content-Type", "application/json")
 	body := map[string]string{
 		"message": message,
 	}
@@ -36,8 +91,9 @@ func (r *Response) ApiError(code int, message string) {
 }
 
 func (r *Response) ApiErrorWithErr(code int, message string, err error) {
+	r.discardBodyReader()
 	r.Status = code
-	r.Headers.Add("content-type", "application/json")
+	r.Headers.Set("Content-Type", "application/json")
 	body := map[string]string{
 		"message": message,
 	}
@@ -52,7 +108,31 @@ func (r *Response) ApiErrorWithErr(code int, message string, err error) {
 	}
 }
 
+// apiErrorDetails responds with the message and details of an ApiError.
+func (r *Response) apiErrorDetails(e ApiError) {
+	if e.Details == nil {
+		r.ApiError(e.StatusCode, e.Message)
+		return
+	}
+
+	r.discardBodyReader()
+	r.Status = e.StatusCode
+	r.Headers.Set("Content-Type", "application/json")
+	body := map[string]any{
+		"message": e.Message,
+		"details": e.Details,
+	}
+
+	data, err := json.Marshal(body)
+	if err != nil {
+		r.ApiError(e.StatusCode, e.Message)
+		return
+	}
+	r.Body = data
+}
+
 func (r *Response) Json(status int, body interface{}) {
+	r.discardBodyReader()
 	r.Status = status
 	r.Headers.Add("content-type", "application/json")
 
@@ -64,13 +144,23 @@ func (r *Response) Json(status int, body interface{}) {
 	r.Body = json
 }
 
+// Redirect responds with the given 3xx status and Location header.
+func (r *Response) Redirect(status int, location string) {
+	r.discardBodyReader()
+	r.Status = status
+	r.Headers.Add("Location", location)
+	r.Body = []byte{}
+}
+
 func (r *Response) TextPlain(status int, body string) {
+	r.discardBodyReader()
 	r.Status = status
 	r.Headers.Add("content-type", "text/plain")
 	r.Body = []byte(body)
 }
 
 func (r *Response) Raw(status int, body []byte) {
+	r.discardBodyReader()
 	r.Status = status
 	r.Headers.Add("content-type", "application/octet-stream")
 	r.Body = body
@@ -144,17 +234,79 @@ func statusText(code int) string {
 	return "Unknown Status"
 }
 
+// appendHead appends the status line and headers, without the terminating
+// empty line, to buf.
+func (r *Response) appendHead(buf []byte) []byte {
+	buf = append(buf, "HTTP/1.1 "...)
+	buf = strconv.AppendInt(buf, int64(r.Status), 10)
+	buf = append(buf, ' ')
+	buf = append(buf, statusText(r.Status)...)
+	buf = append(buf, "\r\n"...)
+	for _, h := range r.Headers.Values {
+		buf = append(buf, h...)
+		buf = append(buf, "\r\n"...)
+	}
+	return buf
+}
+
+// Bodies up to this size are copied behind the headers and sent with a single
+// Write; larger ones are sent together with the head as a vectored write.
+const inlineBodySize = 16 << 10
+
 func (r *Response) Done() {
 	r.handleSecurityHeaders()
+	encode := r.applyCompression()
 
-	response := fmt.Sprintf("HTTP/1.1 %d %s\r\n%s\r\n", r.Status, statusText(r.Status), strings.Join(r.Headers.Values, "\r\n"))
-	r.conn.Write([]byte(response))
+	bufp := writeBufferPool.Get().(*[]byte)
+	buf := r.appendHead((*bufp)[:0])
 
-	if r.Body != nil {
-		r.conn.Write([]byte(fmt.Sprintf("Content-Length: %d\r\n\r\n", len(r.Body))))
-		r.conn.Write(r.Body)
+	if r.bodyReader != nil {
+		if r.bodyLength >= 0 && encode == nil {
+			buf = append(buf, "Content-Length: "...)
+			buf = strconv.AppendInt(buf, r.bodyLength, 10)
+			buf = append(buf, "\r\n"...)
+		}
+		buf = append(buf, "\r\n"...)
+	} else if r.Body != nil {
+		buf = append(buf, "Content-Length: "...)
+		buf = strconv.AppendInt(buf, int64(len(r.Body)), 10)
+		buf = append(buf, "\r\n\r\n"...)
 	} else {
-		r.conn.Write([]byte("\r\n\r\n"))
+		buf = append(buf, "\r\n"...)
+	}
+
+	if r.bodyReader != nil {
+		if _, err := r.conn.Write(buf); err == nil && !r.omitBody {
+			// io.Copy lets the connection use sendfile for *os.File readers.
+			// A negative length means the body is delimited by closing the
+			// connection, as is a body compressed on the fly.
+			body := r.bodyReader
+			if r.bodyLength >= 0 {
+				body = io.LimitReader(body, r.bodyLength)
+			}
+			if encode != nil {
+				if w, err := encode(r.conn, r.compression.options.Level); err == nil {
+					io.Copy(w, body)
+					w.Close()
+				}
+			} else {
+				io.Copy(r.conn, body)
+			}
+		}
+		r.discardBodyReader()
+	} else if r.omitBody || len(r.Body) == 0 {
+		r.conn.Write(buf)
+	} else if len(r.Body) <= inlineBodySize {
+		buf = append(buf, r.Body...)
+		r.conn.Write(buf)
+	} else {
+		bufs := net.Buffers{buf, r.Body}
+		bufs.WriteTo(r.conn)
+	}
+
+	if cap(buf) <= 64<<10 {
+		*bufp = buf
+		writeBufferPool.Put(bufp)
 	}
 
 	r.conn.Close()
@@ -166,16 +318,13 @@ type EventStream struct {
 }
 
 func (r *Response) StreamEvents() {
-	head := fmt.Sprintf(
-		"HTTP/1.1 %d %s\r\n%s\r\n",
-		r.Status,
-		statusText(r.Status),
-		strings.Join(r.Headers.Values, "\r\n"),
-	)
-	r.conn.Write([]byte(head))
-	r.conn.Write([]byte("Content-Type: text/event-stream\n\n"))
+	w, flush, closeStream := r.eventStreamWriter()
+	head := r.appendHead(nil)
+	head = append(head, "Content-Type: text/event-stream\r\n\r\n"...)
+	r.conn.Write(head)
 
 	defer r.conn.Close()
+	defer closeStream()
 	for {
 		select {
 		case msg, ok := <-*r.EventStream.Ch:
@@ -183,7 +332,10 @@ func (r *Response) StreamEvents() {
 				return
 			}
 
-			_, err := r.conn.Write([]byte(fmt.Sprintf("data: %s\n\n", msg)))
+			_, err := w.Write([]byte("data: " + msg + "\n\n"))
+			if err == nil {
+				err = flush()
+			}
 			if err != nil {
 				return
 			}
@@ -1,9 +1,18 @@
 package gonanoweb
 
+import "time"
+
 type Router struct {
 	Path  string
 	Stack []IStackable
 	IStackable
+
+	// Optional settings scoped to the routes of this router and its children.
+	MaxRequestSize *int64
+	ReadTimeout    *time.Duration
+	WriteTimeout   *time.Duration
+	CorsOptions    *CorsOptions
+	ErrorHandler   ErrorHandler
 }
 
 func NewRouter() *Router {
@@ -1,46 +1,40 @@
 package gonanoweb
 
-func (r *Router) Get(path string, handler Handler, middlewares ...Middleware) {
-	validatePath(path)
-	for _, m := range middlewares {
-		r.Stack = append(r.Stack, m)
-	}
-
-	r.Stack = append(r.Stack, Route{Path: path, Handler: handler, Method: "GET"})
-}
+import "strings"
 
-func (r *Router) Post(path string, handler Handler, middlewares ...Middleware) {
+// Handle registers a handler for an arbitrary HTTP method. The middlewares
+// only run for this route, right before its handler.
+func (r *Router) Handle(method string, path string, handler Handler, middlewares ...Middleware) *Route {
 	validatePath(path)
-	for _, m := range middlewares {
-		r.Stack = append(r.Stack, m)
-	}
+	route := &Route{Path: path, Handler: handler, Method: strings.ToUpper(method), middlewares: middlewares}
+	r.Stack = append(r.Stack, route)
+	return route
+}
 
-	r.Stack = append(r.Stack, Route{Path: path, Handler: handler, Method: "POST"})
+func (r *Router) Get(path string, handler Handler, middlewares ...Middleware) *Route {
+	return r.Handle("GET", path, handler, middlewares...)
 }
 
-func (r *Router) Put(path string, handler Handler, middlewares ...Middleware) {
-	validatePath(path)
-	for _, m := range middlewares {
-		r.Stack = append(r.Stack, m)
-	}
+func (r *Router) Post(path string, handler Handler, middlewares ...Middleware) *Route {
+	return r.Handle("POST", path, handler, middlewares...)
+}
 
-	r.Stack = append(r.Stack, Route{Path: path, Handler: handler, Method: "PUT"})
+func (r *Router) Put(path string, handler Handler, middlewares ...Middleware) *Route {
+	return r.Handle("PUT", path, handler, middlewares...)
 }
 
-func (r *Router) Patch(path string, handler Handler, middlewares ...Middleware) {
-	validatePath(path)
-	for _, m := range middlewares {
-		r.Stack = append(r.Stack, m)
-	}
+func (r *Router) Patch(path string, handler Handler, middlewares ...Middleware) *Route {
+	return r.Handle("PATCH", path, handler, middlewares...)
+}
 
-	r.Stack = append(r.Stack, Route{Path: path, Handler: handler, Method: "PATCH"})
+func (r *Router) Delete(path string, handler Handler, middlewares ...Middleware) *Route {
+	return r.Handle("DELETE", path, handler, middlewares...)
 }
 
-func (r *Router) Delete(path string, handler Handler, middlewares ...Middleware) {
-	validatePath(path)
-	for _, m := range middlewares {
-		r.Stack = append(r.Stack, m)
-	}
+func (r *Router) Head(path string, handler Handler, middlewares ...Middleware) *Route {
+	return r.Handle("HEAD", path, handler, middlewares...)
+}
 
-	r.Stack = append(r.Stack, Route{Path: path, Handler: handler, Method: "DELETE"})
+func (r *Router) Options(path string, handler Handler, middlewares ...Middleware) *Route {
+	return r.Handle("OPTIONS", path, handler, middlewares...)
 }
@@ -0,0 +1,283 @@
+package gonanoweb
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"reflect"
+	"runtime"
+	"slices"
+	"strings"
+)
+
+func joinPath(parent string, path string) string {
+	return strings.TrimSuffix(parent, "/") + "/" + strings.TrimPrefix(path, "/")
+}
+
+// routeEntry is a route as seen from the server: its host pattern (empty for
+// the default host), full path and the middlewares that run before it.
+type routeEntry struct {
+	route *Route
+	host  string
+	path  string
+	chain []Middleware
+}
+
+// walkRoutes calls fn for every route reachable from stackable, in matching
+// order. Walking stops when fn returns false.
+func walkRoutes(stackable IStackable, entry routeEntry, fn func(entry routeEntry) bool) bool {
+	if route, ok := stackable.(Route); ok {
+		stackable = &route
+	}
+	switch s := stackable.(type) {
+	case *Route:
+		entry.route = s
+		entry.path = joinPath(entry.path, s.Path)
+		entry.chain = slices.Concat(entry.chain, s.middlewares)
+		return fn(entry)
+	case *Router:
+		entry.path = joinPath(entry.path, s.Path)
+		return walkStack(s.Stack, entry, fn)
+	case *Server:
+		entry.path = "/"
+		if !walkStack(s.Stack, entry, fn) {
+			return false
+		}
+		for _, h := range s.hosts {
+			hostEntry := entry
+			hostEntry.host = h.pattern
+			hostEntry.chain = s.middlewares()
+			if !walkRoutes(h.router, hostEntry, fn) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+func walkStack(stack []IStackable, entry routeEntry, fn func(entry routeEntry) bool) bool {
+	// Capping the capacity makes appends copy, so middlewares registered in a
+	// router never leak into the chains of its parent's later routes.
+	entry.chain = entry.chain[:len(entry.chain):len(entry.chain)]
+	for _, child := range stack {
+		if m, ok := child.(Middleware); ok {
+			entry.chain = append(entry.chain, m)
+			continue
+		}
+		if !walkRoutes(child, entry, fn) {
+			return false
+		}
+	}
+	return true
+}
+
+// RouteInfo describes a registered route.
+type RouteInfo struct {
+	Host        string // Host pattern, empty for the default host
+	Method      string
+	Path        string
+	Name        string
+	Handler     string
+	Middlewares []string
+}
+
+// Routes lists every registered route in matching order.
+func (s *Server) Routes() []RouteInfo {
+	var routes []RouteInfo
+	walkRoutes(s, routeEntry{}, func(entry routeEntry) bool {
+		info := RouteInfo{
+			Host:    entry.host,
+			Method:  entry.route.Method,
+			Path:    entry.path,
+			Name:    entry.route.name,
+			Handler: funcName(entry.route.Handler),
+		}
+		for _, m := range entry.chain {
+			info.Middlewares = append(info.Middlewares, funcName(m.Handler))
+		}
+		routes = append(routes, info)
+		return true
+	})
+	return routes
+}
+
+func funcName(fn interface{}) string {
+	v := reflect.ValueOf(fn)
+	if v.Kind() != reflect.Func || v.IsNil() {
+		return ""
+	}
+	if f := runtime.FuncForPC(v.Pointer()); f != nil {
+		return f.Name()
+	}
+	return ""
+}
+
+// ValidateRoutes reports routes that can never be reached because an earlier
+// route with the same method matches every path they match (including exact
+// duplicates), pairs of routes that overlap without either being more
+// specific so that registration order silently decides, and duplicate route
+// names. Listen refuses to start when it returns an error.
+func (s *Server) ValidateRoutes() error {
+	type registered struct {
+		host          string
+		method        string
+		path          string
+		segments      []string
+		trailingSlash bool
+	}
+
+	var errs []error
+	var seen []registered
+	names := map[string]string{}
+
+	walkRoutes(s, routeEntry{}, func(entry routeEntry) bool {
+		route := entry.route
+		where := route.Method + " " + entry.host + entry.path
+		if route.name != "" {
+			if other, ok := names[route.name]; ok {
+				errs = append(errs, fmt.Errorf("route name %q used by both %s and %s", route.name, other, where))
+			} else {
+				names[route.name] = where
+			}
+		}
+
+		current := registered{host: entry.host, method: route.Method, path: where, segments: splitSegments(entry.path)}
+		if opts := s.PathOptions; opts != nil {
+			if opts.TrailingSlash != TrailingSlashLenient {
+				current.trailingSlash = routeHasTrailingSlash(route.Path)
+			}
+			if opts.CaseInsensitive {
+				for i, segment := range current.segments {
+					current.segments[i] = strings.ToLower(segment)
+				}
+			}
+		}
+
+		for _, earlier := range seen {
+			if earlier.method != current.method || earlier.host != current.host || earlier.trailingSlash != current.trailingSlash {
+				continue
+			}
+			switch {
+			case segmentsCover(earlier.segments, current.segments):
+				errs = append(errs, fmt.Errorf("%s is unreachable: shadowed by %s", current.path, earlier.path))
+			case segmentsCover(current.segments, earlier.segments):
+				// The earlier route is more specific; both stay reachable.
+			case segmentsOverlap(earlier.segments, current.segments):
+				errs = append(errs, fmt.Errorf("%s is ambiguous with %s", current.path, earlier.path))
+			}
+		}
+		seen = append(seen, current)
+		return true
+	})
+
+	return errors.Join(errs...)
+}
+
+func splitSegments(path string) []string {
+	var segments []string
+	for {
+		var segment string
+		segment, path = nextSegment(path)
+		if segment == "" {
+			return segments
+		}
+		segments = append(segments, segment)
+	}
+}
+
+func isParamSegment(segment string) bool {
+	return strings.HasPrefix(segment, ":")
+}
+
+func isWildcardSegment(segment string) bool {
+	return strings.HasPrefix(segment, "*")
+}
+
+// segmentsCover reports whether every path matched by b is also matched by a.
+func segmentsCover(a, b []string) bool {
+	for i := 0; ; i++ {
+		if i < len(a) && isWildcardSegment(a[i]) {
+			return true
+		}
+		if i == len(a) || i == len(b) {
+			return len(a) == len(b)
+		}
+		if isWildcardSegment(b[i]) {
+			return false
+		}
+		if !isParamSegment(a[i]) && (isParamSegment(b[i]) || a[i] != b[i]) {
+			return false
+		}
+	}
+}
+
+// segmentsOverlap reports whether at least one path is matched by both.
+func segmentsOverlap(a, b []string) bool {
+	for i := 0; ; i++ {
+		if (i < len(a) && isWildcardSegment(a[i])) || (i < len(b) && isWildcardSegment(b[i])) {
+			return true
+		}
+		if i == len(a) || i == len(b) {
+			return len(a) == len(b)
+		}
+		if !isParamSegment(a[i]) && !isParamSegment(b[i]) && a[i] != b[i] {
+			return false
+		}
+	}
+}
+
+// URL builds the path of the route registered under name, substituting the
+// :params from params and appending query. It fails if the route is unknown
+// or a parameter is missing.
+func (s *Server) URL(name string, params map[string]string, query url.Values) (string, error) {
+	var pattern string
+	var trailingSlash bool
+	walkRoutes(s, routeEntry{}, func(entry routeEntry) bool {
+		if entry.route.name == name {
+			pattern = entry.path
+			trailingSlash = routeHasTrailingSlash(entry.route.Path)
+			return false
+		}
+		return true
+	})
+	if pattern == "" {
+		return "", fmt.Errorf("no route named %q", name)
+	}
+
+	var b strings.Builder
+	for rest := pattern; ; {
+		var segment string
+		segment, rest = nextSegment(rest)
+		if segment == "" {
+			break
+		}
+
+		if isWildcardSegment(segment) {
+			for _, part := range strings.Split(params[segment[1:]], "/") {
+				b.WriteByte('/')
+				b.WriteString(url.PathEscape(part))
+			}
+			break
+		}
+
+		b.WriteByte('/')
+		if strings.HasPrefix(segment, ":") {
+			value, ok := params[segment[1:]]
+			if !ok || value == "" {
+				return "", fmt.Errorf("route %q: missing parameter %q", name, segment[1:])
+			}
+			b.WriteString(url.PathEscape(value))
+		} else {
+			b.WriteString(segment)
+		}
+	}
+	if b.Len() == 0 || trailingSlash {
+		b.WriteByte('/')
+	}
+
+	if len(query) > 0 {
+		b.WriteByte('?')
+		b.WriteString(query.Encode())
+	}
+	return b.String(), nil
+}
@@ -0,0 +1,273 @@
+package gonanoweb
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	ErrInvalidCookie = errors.New("cookie signature or encryption is invalid")
+	ErrExpiredCookie = errors.New("cookie has expired")
+	errNoKeyring     = errors.New("no CookieKeyring with keys configured on the server")
+)
+
+// CookieKeyring holds the secrets used for signed and encrypted cookies,
+// newest first. Cookies are always written with the newest key and accepted
+// if any key verifies them, so keys can be rotated without logging everyone
+// out: add the new key, and drop the old one once its cookies have expired.
+type CookieKeyring struct {
+	mu   sync.RWMutex
+	keys []cookieKey
+}
+
+type cookieKey struct {
+	sign    []byte
+	encrypt cipher.AEAD
+}
+
+// NewCookieKeyring creates a keyring from secrets of at least 32 bytes,
+// newest first.
+func NewCookieKeyring(secrets ...[]byte) (*CookieKeyring, error) {
+	if len(secrets) == 0 {
+		return nil, errors.New("cookie keyring needs at least one secret")
+	}
+
+	k := &CookieKeyring{}
+	for _, secret := range secrets {
+		key, err := newCookieKey(secret)
+		if err != nil {
+			return nil, err
+		}
+		k.keys = append(k.keys, key)
+	}
+	return k, nil
+}
+
+// Rotate makes secret the newest key. At most keep keys are retained, 0
+// keeps all of them.
+func (k *CookieKeyring) Rotate(secret []byte, keep int) error {
+	key, err := newCookieKey(secret)
+	if err != nil {
+		return err
+	}
+
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	k.keys = append([]cookieKey{key}, k.keys...)
+	if keep > 0 && len(k.keys) > keep {
+		k.keys = k.keys[:keep]
+	}
+	return nil
+}
+
+// newCookieKey derives separate signing and encryption keys from secret so
+// the same secret is never used for both.
+func newCookieKey(secret []byte) (cookieKey, error) {
+	if len(secret) < 32 {
+		return cookieKey{}, errors.New("cookie secrets must be at least 32 bytes")
+	}
+
+	derive := func(purpose string) []byte {
+		mac := hmac.New(sha256.New, secret)
+		mac.Write([]byte("gonanoweb cookie " + purpose))
+		return mac.Sum(nil)
+	}
+
+	block, err := aes.NewCipher(derive("encryption"))
+	if err != nil {
+		return cookieKey{}, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return cookieKey{}, err
+	}
+	return cookieKey{sign: derive("signing"), encrypt: aead}, nil
+}
+
+func (k *CookieKeyring) snapshot() []cookieKey {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+	return k.keys
+}
+
+// cookiePayload prefixes the value with its expiry (0 for session cookies)
+// so an expired cookie cannot be replayed even if the client keeps it.
+func cookiePayload(cookie *Cookie) []byte {
+	var expires int64
+	switch {
+	case cookie.MaxAge > 0:
+		expires = time.Now().Add(time.Duration(cookie.MaxAge) * time.Second).Unix()
+	case cookie.MaxAge == 0 && !cookie.Expires.IsZero():
+		expires = cookie.Expires.Unix()
+	}
+
+	payload := make([]byte, 8, 8+len(cookie.Value))
+	binary.BigEndian.PutUint64(payload, uint64(expires))
+	return append(payload, cookie.Value...)
+}
+
+func openCookiePayload(name string, payload []byte) (*Cookie, error) {
+	if len(payload) < 8 {
+		return nil, ErrInvalidCookie
+	}
+	if expires := int64(binary.BigEndian.Uint64(payload)); expires != 0 && time.Now().Unix() > expires {
+		return nil, ErrExpiredCookie
+	}
+	return &Cookie{Name: name, Value: string(payload[8:])}, nil
+}
+
+func signCookie(key cookieKey, name string, payload []byte) []byte {
+	mac := hmac.New(sha256.New, key.sign)
+	mac.Write([]byte(name))
+	mac.Write([]byte{0})
+	mac.Write(payload)
+	return mac.Sum(nil)
+}
+
+// keysOrError returns the current keys, newest first. A nil or zero-value
+// keyring has none and yields errNoKeyring.
+func (k *CookieKeyring) keysOrError() ([]cookieKey, error) {
+	if k == nil {
+		return nil, errNoKeyring
+	}
+	keys := k.snapshot()
+	if len(keys) == 0 {
+		return nil, errNoKeyring
+	}
+	return keys, nil
+}
+
+func (r *Response) cookieKeys() ([]cookieKey, error) {
+	if r.Server == nil {
+		return nil, errNoKeyring
+	}
+	return r.Server.CookieKeyring.keysOrError()
+}
+
+func (r *Request) cookieKeys() ([]cookieKey, error) {
+	if r.server == nil {
+		return nil, errNoKeyring
+	}
+	return r.server.CookieKeyring.keysOrError()
+}
+
+// SetSignedCookie sets a cookie whose value can be read by the client but
+// not changed: it carries an HMAC-SHA256 of the name, value and expiry.
+func (r *Response) SetSignedCookie(cookie *Cookie) error {
+	keys, err := r.cookieKeys()
+	if err != nil {
+		return err
+	}
+
+	payload := cookiePayload(cookie)
+	signature := signCookie(keys[0], cookie.Name, payload)
+
+	signed := *cookie
+	signed.Value = base64.RawURLEncoding.EncodeToString(payload) + "." + base64.RawURLEncoding.EncodeToString(signature)
+	return r.setSecureCookie(&signed)
+}
+
+// SignedCookie returns the verified value of a cookie set with
+// SetSignedCookie, or ErrNoCookie, ErrInvalidCookie or ErrExpiredCookie.
+func (r *Request) SignedCookie(name string) (*Cookie, error) {
+	keys, err := r.cookieKeys()
+	if err != nil {
+		return nil, err
+	}
+	cookie, err := r.Cookie(name)
+	if err != nil {
+		return nil, err
+	}
+
+	encodedPayload, encodedSignature, ok := strings.Cut(cookie.Value, ".")
+	if !ok {
+		return nil, ErrInvalidCookie
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(encodedPayload)
+	if err != nil {
+		return nil, ErrInvalidCookie
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(encodedSignature)
+	if err != nil {
+		return nil, ErrInvalidCookie
+	}
+
+	for _, key := range keys {
+		if hmac.Equal(signature, signCookie(key, name, payload)) {
+			return openCookiePayload(name, payload)
+		}
+	}
+	return nil, ErrInvalidCookie
+}
+
+// SetEncryptedCookie sets a cookie whose value is encrypted and
+// authenticated with AES-GCM, so the client can neither read nor change it.
+func (r *Response) SetEncryptedCookie(cookie *Cookie) error {
+	keys, err := r.cookieKeys()
+	if err != nil {
+		return err
+	}
+
+	aead := keys[0].encrypt
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return err
+	}
+	sealed := aead.Seal(nonce, nonce, cookiePayload(cookie), []byte(cookie.Name))
+
+	encrypted := *cookie
+	encrypted.Value = base64.RawURLEncoding.EncodeToString(sealed)
+	return r.setSecureCookie(&encrypted)
+}
+
+// EncryptedCookie returns the decrypted value of a cookie set with
+// SetEncryptedCookie, or ErrNoCookie, ErrInvalidCookie or ErrExpiredCookie.
+func (r *Request) EncryptedCookie(name string) (*Cookie, error) {
+	keys, err := r.cookieKeys()
+	if err != nil {
+		return nil, err
+	}
+	cookie, err := r.Cookie(name)
+	if err != nil {
+		return nil, err
+	}
+
+	sealed, err := base64.RawURLEncoding.DecodeString(cookie.Value)
+	if err != nil {
+		return nil, ErrInvalidCookie
+	}
+
+	for _, key := range keys {
+		nonceSize := key.encrypt.NonceSize()
+		if len(sealed) < nonceSize {
+			return nil, ErrInvalidCookie
+		}
+		payload, err := key.encrypt.Open(nil, sealed[:nonceSize], sealed[nonceSize:], []byte(name))
+		if err == nil {
+			return openCookiePayload(name, payload)
+		}
+	}
+	return nil, ErrInvalidCookie
+}
+
+// setSecureCookie rejects cookies browsers would silently drop.
+func (r *Response) setSecureCookie(cookie *Cookie) error {
+	value, err := cookie.String()
+	if err != nil {
+		return err
+	}
+	if len(value) > 4096 {
+		return errors.New("cookie " + cookie.Name + " exceeds 4096 bytes")
+	}
+	r.Headers.Add("Set-Cookie", value)
+	return nil
+}
@@ -0,0 +1,239 @@
+package gonanoweb
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+var (
+	testSecretA = bytes.Repeat([]byte("a"), 32)
+	testSecretB = bytes.Repeat([]byte("b"), 32)
+)
+
+type secureCookieFuncs struct {
+	name string
+	set  func(res *Response, cookie *Cookie) error
+	get  func(req *Request, name string) (*Cookie, error)
+}
+
+var secureCookieKinds = []secureCookieFuncs{
+	{name: "signed", set: (*Response).SetSignedCookie, get: (*Request).SignedCookie},
+	{name: "encrypted", set: (*Response).SetEncryptedCookie, get: (*Request).EncryptedCookie},
+}
+
+func newCookieTestServer(t *testing.T, secrets ...[]byte) *Server {
+	t.Helper()
+	keyring, err := NewCookieKeyring(secrets...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return NewServer(":0", &ServerOptions{CookieKeyring: keyring})
+}
+
+// setCookieValue sets a cookie on a fresh response and returns the
+// "name=value" pair a client would send back.
+func setCookieValue(t *testing.T, s *Server, kind secureCookieFuncs, cookie *Cookie) string {
+	t.Helper()
+	res := &Response{Server: s}
+	if err := kind.set(res, cookie); err != nil {
+		t.Fatalf("setting cookie: %v", err)
+	}
+	pair, _, _ := strings.Cut(res.Headers.Get("Set-Cookie"), ";")
+	return pair
+}
+
+func requestWithCookie(s *Server, header string) *Request {
+	req := NewRequest()
+	req.server = s
+	req.Headers = map[string]string{"cookie": header}
+	return req
+}
+
+func TestSecureCookieRoundTrip(t *testing.T) {
+	values := []string{"", "plain", "theme=dark, lang=en", `quote " and ; semicolon`, "ünïcödé", strings.Repeat("x", 1000)}
+
+	for _, kind := range secureCookieKinds {
+		for _, value := range values {
+			t.Run(kind.name+"/"+value, func(t *testing.T) {
+				s := newCookieTestServer(t, testSecretA)
+				pair := setCookieValue(t, s, kind, NewCookie("prefs", value, &CookieOptions{Path: "/", MaxAge: 60}))
+
+				cookie, err := kind.get(requestWithCookie(s, pair), "prefs")
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				if cookie.Value != value {
+					t.Errorf("got %q, want %q", cookie.Value, value)
+				}
+			})
+		}
+	}
+}
+
+func TestEncryptedCookieHidesValue(t *testing.T) {
+	s := newCookieTestServer(t, testSecretA)
+	kind := secureCookieKinds[1]
+	first := setCookieValue(t, s, kind, NewCookie("sess", "user-42", nil))
+	second := setCookieValue(t, s, kind, NewCookie("sess", "user-42", nil))
+
+	if strings.Contains(first, "user-42") || strings.Contains(first, "dXNlci00Mg") {
+		t.Errorf("value is readable in %q", first)
+	}
+	if first == second {
+		t.Error("encrypting the same value twice gave the same cookie")
+	}
+}
+
+func TestSecureCookieRejectsTampering(t *testing.T) {
+	for _, kind := range secureCookieKinds {
+		t.Run(kind.name, func(t *testing.T) {
+			s := newCookieTestServer(t, testSecretA)
+			pair := setCookieValue(t, s, kind, NewCookie("sess", "user-42", nil))
+			value := strings.TrimPrefix(pair, "sess=")
+
+			flip := func(value string, i int) string {
+				c := byte('A')
+				if value[i] == 'A' {
+					c = 'B'
+				}
+				return value[:i] + string(c) + value[i+1:]
+			}
+
+			otherPair := setCookieValue(t, s, kind, NewCookie("other", "user-1", nil))
+			tampered := map[string]string{
+				"first byte changed":     "sess=" + flip(value, 2),
+				"middle byte changed":    "sess=" + flip(value, len(value)/2),
+				"truncated":              "sess=" + value[:len(value)-4],
+				"extended":               "sess=" + value + "AAAA",
+				"empty":                  "sess=",
+				"not base64":             "sess=!!!!.####",
+				"signature only":         "sess=." + value,
+				"cookie from other name": "sess=" + strings.TrimPrefix(otherPair, "other="),
+			}
+
+			for name, header := range tampered {
+				if _, err := kind.get(requestWithCookie(s, header), "sess"); !errors.Is(err, ErrInvalidCookie) {
+					t.Errorf("%s: got %v, want ErrInvalidCookie", name, err)
+				}
+			}
+			if _, err := kind.get(requestWithCookie(s, "other="+value), "other"); !errors.Is(err, ErrInvalidCookie) {
+				t.Errorf("moved to another name: got %v, want ErrInvalidCookie", err)
+			}
+
+			other := newCookieTestServer(t, testSecretB)
+			if _, err := kind.get(requestWithCookie(other, pair), "sess"); !errors.Is(err, ErrInvalidCookie) {
+				t.Errorf("other key: got %v, want ErrInvalidCookie", err)
+			}
+		})
+	}
+}
+
+func TestSecureCookieExpiry(t *testing.T) {
+	tests := []struct {
+		name    string
+		options CookieOptions
+		expires time.Time
+		wantErr error
+	}{
+		{name: "session cookie"},
+		{name: "max age in the future", options: CookieOptions{MaxAge: 60}},
+		{name: "expires in the future", expires: time.Now().Add(time.Hour)},
+		{name: "expired", expires: time.Now().Add(-time.Hour), wantErr: ErrExpiredCookie},
+	}
+
+	for _, kind := range secureCookieKinds {
+		for _, tt := range tests {
+			t.Run(kind.name+"/"+tt.name, func(t *testing.T) {
+				s := newCookieTestServer(t, testSecretA)
+				cookie := NewCookie("sess", "user-42", &tt.options)
+				cookie.Expires = tt.expires
+				pair := setCookieValue(t, s, kind, cookie)
+
+				if _, err := kind.get(requestWithCookie(s, pair), "sess"); !errors.Is(err, tt.wantErr) {
+					t.Errorf("got %v, want %v", err, tt.wantErr)
+				}
+			})
+		}
+	}
+}
+
+func TestSecureCookieKeyRotation(t *testing.T) {
+	for _, kind := range secureCookieKinds {
+		t.Run(kind.name, func(t *testing.T) {
+			s := newCookieTestServer(t, testSecretA)
+			oldPair := setCookieValue(t, s, kind, NewCookie("sess", "old", nil))
+
+			if err := s.CookieKeyring.Rotate(testSecretB, 0); err != nil {
+				t.Fatal(err)
+			}
+			if cookie, err := kind.get(requestWithCookie(s, oldPair), "sess"); err != nil || cookie.Value != "old" {
+				t.Fatalf("old cookie after rotation: got %v, %v", cookie, err)
+			}
+
+			// New cookies are written with the newest key only.
+			newPair := setCookieValue(t, s, kind, NewCookie("sess", "new", nil))
+			onlyB := newCookieTestServer(t, testSecretB)
+			if cookie, err := kind.get(requestWithCookie(onlyB, newPair), "sess"); err != nil || cookie.Value != "new" {
+				t.Fatalf("new cookie with newest key: got %v, %v", cookie, err)
+			}
+			onlyA := newCookieTestServer(t, testSecretA)
+			if _, err := kind.get(requestWithCookie(onlyA, newPair), "sess"); !errors.Is(err, ErrInvalidCookie) {
+				t.Fatalf("new cookie with old key: got %v, want ErrInvalidCookie", err)
+			}
+
+			// Dropping the old key invalidates cookies written with it.
+			if err := s.CookieKeyring.Rotate(bytes.Repeat([]byte("c"), 32), 2); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := kind.get(requestWithCookie(s, oldPair), "sess"); !errors.Is(err, ErrInvalidCookie) {
+				t.Errorf("old cookie after its key was dropped: got %v, want ErrInvalidCookie", err)
+			}
+			if _, err := kind.get(requestWithCookie(s, newPair), "sess"); err != nil {
+				t.Errorf("new cookie after second rotation: %v", err)
+			}
+		})
+	}
+}
+
+func TestSecureCookieErrors(t *testing.T) {
+	if _, err := NewCookieKeyring(); err == nil {
+		t.Error("expected an error for a keyring without secrets")
+	}
+	if _, err := NewCookieKeyring(testSecretA, []byte("short")); err == nil {
+		t.Error("expected an error for a short secret")
+	}
+	if err := (&CookieKeyring{}).Rotate([]byte("short"), 0); err == nil {
+		t.Error("expected an error when rotating in a short secret")
+	}
+
+	for _, kind := range secureCookieKinds {
+		t.Run(kind.name, func(t *testing.T) {
+			servers := map[string]*Server{
+				"no keyring":         NewServer(":0", nil),
+				"zero value keyring": NewServer(":0", &ServerOptions{CookieKeyring: &CookieKeyring{}}),
+			}
+			for name, s := range servers {
+				if err := kind.set(&Response{Server: s}, NewCookie("sess", "x", nil)); !errors.Is(err, errNoKeyring) {
+					t.Errorf("%s: set got %v, want errNoKeyring", name, err)
+				}
+				if _, err := kind.get(requestWithCookie(s, "sess=x"), "sess"); !errors.Is(err, errNoKeyring) {
+					t.Errorf("%s: get got %v, want errNoKeyring", name, err)
+				}
+			}
+
+			s := newCookieTestServer(t, testSecretA)
+			if _, err := kind.get(requestWithCookie(s, "other=x"), "sess"); !errors.Is(err, ErrNoCookie) {
+				t.Errorf("missing cookie: got %v, want ErrNoCookie", err)
+			}
+			if err := kind.set(&Response{Server: s}, NewCookie("sess", strings.Repeat("x", 4000), nil)); err == nil {
+				t.Error("expected an error for a cookie over 4096 bytes")
+			}
+			if err := kind.set(&Response{Server: s}, NewCookie("bad name", "x", nil)); err == nil {
+				t.Error("expected an error for an invalid cookie name")
+			}
+		})
+	}
+}
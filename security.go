@@ -2,6 +2,7 @@ package gonanoweb
 
 import (
 	"crypto/rand"
+	"crypto/subtle"
 	"encoding/base64"
 	"errors"
 	"net/http"
@@ -30,12 +31,13 @@ type SecurityOptions struct {
 }
 
 type CookieOptions struct {
-	Path     string
-	Domain   string
-	MaxAge   int
-	Secure   bool
-	HttpOnly bool
-	SameSite http.SameSite
+	Path        string
+	Domain      string
+	MaxAge      int
+	Secure      bool
+	HttpOnly    bool
+	SameSite    http.SameSite
+	Partitioned bool // CHIPS: key the cookie to the top-level site, requires Secure
 }
 
 func DefaultSecurityOptions() SecurityOptions {
@@ -120,24 +122,18 @@ func SecurityMiddleware(options *SecurityOptions) Middleware {
 			if options.EnableCSRF && (req.Method == "POST" || req.Method == "PUT" ||
 				req.Method == "PATCH" || req.Method == "DELETE") {
 
-				csrfCookie, hasCookie := req.Headers["cookie"]
-				if !hasCookie {
+				csrfCookie, err := req.Cookie(options.CSRFCookieName)
+				if err != nil {
 					return errors.New("missing CSRF cookie")
 				}
-
-				cookieTokenParts := strings.Split(csrfCookie, options.CSRFCookieName+"=")
-				if len(cookieTokenParts) < 2 {
-					return errors.New("invalid CSRF cookie")
-				}
-
-				cookieToken := strings.Split(cookieTokenParts[1], ";")[0]
+				cookieToken := csrfCookie.Value
 
 				headerToken, hasHeader := req.Headers[strings.ToLower(options.CSRFHeaderName)]
 				if !hasHeader || headerToken == "" {
 					return errors.New("missing CSRF token in header")
 				}
 
-				if cookieToken != headerToken {
+				if subtle.ConstantTimeCompare([]byte(cookieToken), []byte(headerToken)) != 1 {
 					return errors.New("CSRF token mismatch")
 				}
 			}
@@ -193,42 +189,10 @@ func CSRFTokenMiddleware(options *SecurityOptions) Middleware {
 				}
 			}
 
-			var cookie strings.Builder
-			cookie.WriteString(options.CSRFCookieName)
-			cookie.WriteString("=")
-			cookie.WriteString(token)
-			cookie.WriteString("; Path=")
-			cookie.WriteString(cookieOpts.Path)
-
-			if cookieOpts.Domain != "" {
-				cookie.WriteString("; Domain=")
-				cookie.WriteString(cookieOpts.Domain)
-			}
-
-			if cookieOpts.MaxAge > 0 {
-				cookie.WriteString("; Max-Age=")
-				cookie.WriteString(string(rune(cookieOpts.MaxAge)))
-			}
-
-			if cookieOpts.Secure {
-				cookie.WriteString("; Secure")
-			}
-
-			if cookieOpts.HttpOnly {
-				cookie.WriteString("; HttpOnly")
-			}
-
-			switch cookieOpts.SameSite {
-			case http.SameSiteLaxMode:
-				cookie.WriteString("; SameSite=Lax")
-			case http.SameSiteStrictMode:
-				cookie.WriteString("; SameSite=Strict")
-			case http.SameSiteNoneMode:
-				cookie.WriteString("; SameSite=None")
+			if err := res.SetCookie(NewCookie(options.CSRFCookieName, token, cookieOpts)); err != nil {
+				return err
 			}
 
-			res.Headers.Add("Set-Cookie", cookie.String())
-
 			req.SetData("csrfToken", token)
 
 			return nil
@@ -5,7 +5,6 @@ import (
 	"errors"
 	"fmt"
 	"net"
-	"slices"
 	"strings"
 	"time"
 )
@@ -15,8 +14,24 @@ type ServerOptions struct {
 	WriteTimeout    *time.Duration
 	CorsOptions     *CorsOptions
 	MaxRequestSize  *int64
+	MaxHeaderBytes  *int // Request line plus headers, DefaultMaxHeaderBytes when nil
 	TLSConfig       *tls.Config
 	SecurityHeaders *bool
+	TrustedProxies  []string // CIDRs or IPs allowed to set Forwarded/X-Forwarded-* headers
+	ProxyProtocol   *ProxyProtocolOptions
+
+	MaxConnections        *int
+	MaxConcurrentRequests *int
+	MaxConnectionsPerIP   *int
+	OverloadPolicy        OverloadPolicy
+	RetryAfter            *time.Duration // Retry-After sent with 503 when overloaded
+
+	ErrorHandler ErrorHandler
+	PathOptions  *PathOptions
+	BindOptions  *BindOptions
+
+	FormDataOptions *FormDataOptions // Defaults for FormDataMiddleware and urlencoded limits
+	CookieKeyring   *CookieKeyring   // Keys for signed and encrypted cookies
 }
 
 type Server struct {
@@ -29,8 +44,26 @@ type Server struct {
 	ReadTimeout     *time.Duration
 	WriteTimeout    *time.Duration
 	MaxRequestSize  *int64
+	MaxHeaderBytes  *int
 	SecurityHeaders *bool
 	FormDataOptions *FormDataOptions
+	TrustedProxies  []*net.IPNet
+	ProxyProtocol   *ProxyProtocolOptions
+	tlsConfig       *tls.Config
+
+	MaxConnections        *int
+	MaxConcurrentRequests *int
+	MaxConnectionsPerIP   *int
+	OverloadPolicy        OverloadPolicy
+	RetryAfter            *time.Duration
+	limits                serverLimits
+
+	ErrorHandler ErrorHandler
+	PathOptions  *PathOptions
+	BindOptions  *BindOptions
+	hosts        []hostRoute
+
+	CookieKeyring *CookieKeyring
 }
 
 func NewServer(addr string, options *ServerOptions) *Server {
@@ -53,13 +86,32 @@ func NewServer(addr string, options *ServerOptions) *Server {
 		if options.MaxRequestSize != nil {
 			server.MaxRequestSize = options.MaxRequestSize
 		}
+		server.MaxHeaderBytes = options.MaxHeaderBytes
 		if options.TLSConfig != nil {
 			server.TLSConfig = options.TLSConfig
 		}
 		if options.SecurityHeaders != nil {
 			server.SecurityHeaders = options.SecurityHeaders
 		}
+		if len(options.TrustedProxies) > 0 {
+			server.TrustedProxies = parseTrustedProxies(options.TrustedProxies)
+		}
+		if options.ProxyProtocol != nil {
+			server.ProxyProtocol = options.ProxyProtocol
+			server.ProxyProtocol.allowed = parseTrustedProxies(options.ProxyProtocol.AllowedUpstreams)
+		}
+		server.MaxConnections = options.MaxConnections
+		server.MaxConcurrentRequests = options.MaxConcurrentRequests
+		server.MaxConnectionsPerIP = options.MaxConnectionsPerIP
+		server.OverloadPolicy = options.OverloadPolicy
+		server.RetryAfter = options.RetryAfter
+		server.ErrorHandler = options.ErrorHandler
+		server.PathOptions = options.PathOptions
+		server.BindOptions = options.BindOptions
+		server.FormDataOptions = options.FormDataOptions
+		server.CookieKeyring = options.CookieKeyring
 	}
+	server.setupLimits()
 
 	return server
 }
@@ -74,6 +126,10 @@ func (s *Server) UseRouter(path string, router *Router) {
 }
 
 func (s *Server) Listen() error {
+	if err := s.ValidateRoutes(); err != nil {
+		return fmt.Errorf("invalid routes: %w", err)
+	}
+
 	ln, err := net.Listen("tcp", s.addr)
 	if err != nil {
 		return fmt.Errorf("could not start server: %v", err)
@@ -97,25 +153,35 @@ func (s *Server) ListenTLS(certFile, keyFile string) error {
 	}
 
 	config := &tls.Config{
-		Certificates: []tls.Certificate{cert},
-		MinVersion:   tls.VersionTLS12,
+		MinVersion: tls.VersionTLS12,
 	}
-
-	ln, err := tls.Listen("tcp", s.addr, config)
-	if err != nil {
-		return err
+	if s.TLSConfig != nil {
+		config = s.TLSConfig.Clone()
 	}
-	s.listener = ln
+	config.Certificates = append(config.Certificates, cert)
+
+	// The handshake happens per connection in handleConnection, after any
+	// PROXY protocol header has been consumed from the raw TCP stream.
+	s.tlsConfig = config
 	return s.Listen()
 }
 
 func (s *Server) acceptLoop() {
 	for {
+		s.acquireConnectionSlot()
 		conn, err := s.listener.Accept()
 		if err != nil {
+			if s.limits.connections != nil && s.OverloadPolicy == OverloadBackpressure {
+				<-s.limits.connections
+			}
+			continue
+		}
+
+		tracked := s.trackConnection(conn)
+		if tracked == nil {
 			continue
 		}
-		go s.handleConnection(conn)
+		go s.handleConnection(tracked)
 	}
 }
 
@@ -127,50 +193,127 @@ func (s *Server) handleConnection(conn net.Conn) {
 		conn.SetWriteDeadline(time.Now().Add(*s.WriteTimeout))
 	}
 
-	req := NewRequest()
-	req.server = s
-	req.MaxRequestSize = s.MaxRequestSize
+	var proxyHeader *ProxyHeader
+	if s.ProxyProtocol != nil {
+		pc, err := s.acceptProxyHeader(conn)
+		if err != nil {
+			conn.Close()
+			return
+		}
+		if p, ok := pc.(*proxyConn); ok {
+			proxyHeader = p.header
+		}
+		conn = pc
+	}
+
+	if !s.trackPeer(conn) {
+		s.rejectOverloaded(conn)
+		return
+	}
+
+	if s.tlsConfig != nil {
+		conn = tls.Server(conn, s.tlsConfig)
+	}
+
+	req := acquireRequest(s)
+	req.proxyHeader = proxyHeader
 	req.conn = &conn
+	res := acquireResponse(s)
+	res.conn = conn
+	res.req = req
+	defer func() {
+		releaseRequest(req)
+		// Event streams keep writing to the response after we return.
+		if res.EventStream == nil {
+			releaseResponse(res)
+		}
+	}()
+
 	err := req.parseRequest(conn)
+	if errors.Is(err, ErrHeaderTooLarge) {
+		res.ApiError(431, "Request header fields too large.")
+		res.Done()
+		return
+	}
 	if err != nil {
+		conn.Close()
 		return
 	}
 
-	res := &Response{
-		Server:  s,
-		conn:    conn,
-		Body:    []byte{},
-		Status:  200,
-		Headers: ResponseHeaders{},
+	release := s.acquireRequestSlot()
+	if release == nil {
+		s.overloaded(res)
+		res.Done()
+		return
+	}
+	defer release()
+	if req.Method == "HEAD" {
+		res.omitBody = true
 	}
+
 	var result []IStackable
+	var found bool
+	redirect := s.canonicalPath(req)
+	if redirect == "" {
+		result, found = s.findRoute(req, req.chain)
+		req.chain = result
+		if !found {
+			redirect = s.trailingSlashRedirect(req)
+		}
+	}
+
+	handleCORS(req.corsOptions(), res, req)
+
+	if redirect != "" {
+		if req.rawQuery != "" {
+			redirect += "?" + req.rawQuery
+		}
+		res.Redirect(s.redirectCode(req.Method), redirect)
+		res.Done()
+		return
+	}
 
-	s.handleCORS(res, req)
+	if _, ok := req.Headers["expect"]; ok && !req.expectContinue {
+		res.ApiError(417, "Unsupported expectation.")
+		res.Done()
+		return
+	}
 
-	if req.Method == "OPTIONS" {
+	if !found && req.Method == "OPTIONS" {
 		res.Status = 204
 		res.Body = nil
 		res.Done()
 		return
 	}
-
-	var found bool
-	traverseStackables(req, s, "", &result, &found)
 	if !found {
 		res.ApiError(404, "Unknown route.")
 		res.Done()
 		err = errors.New("Not found!")
 		return
 	}
+
+	req.applyRouteSettings()
+	onError := req.errorHandler()
 outer:
 	for _, h := range result {
 		switch s := h.(type) {
-		case Route:
+		case *Route:
 			{
-				req.parseBody()
+				for _, m := range s.middlewares {
+					if err := m.Handler(res, req); err != nil {
+						onError(res, req, err)
+						res.Done()
+						return
+					}
+				}
+				if err := req.parseBody(); err != nil {
+					onError(res, req, err)
+					res.Done()
+					return
+				}
 				err := s.Handler(res, req)
 				if err != nil {
-					res.ApiError(500, err.Error())
+					onError(res, req, err)
 					res.Done()
 					return
 				}
@@ -180,7 +323,7 @@ outer:
 			{
 				err := s.Handler(res, req)
 				if err != nil {
-					res.ApiError(500, err.Error())
+					onError(res, req, err)
 					res.Done()
 					return
 				}
@@ -201,38 +344,50 @@ outer:
 	}
 }
 
-func traverseStackables(req *Request, stackable IStackable, parentPath string, result *[]IStackable, found *bool) {
+// findRoute resolves the middleware chain and route for the request, falling
+// back from HEAD to GET routes. For a preflight OPTIONS request without an
+// explicit OPTIONS route it still resolves the routers of any route on the
+// path, so their CORS settings apply, but reports not found.
+func (s *Server) findRoute(req *Request, result []IStackable) ([]IStackable, bool) {
+	var found bool
+	traverseStackables(req, req.Method, s, "", &result, &found)
+	if !found && req.Method == "HEAD" {
+		result = result[:0]
+		traverseStackables(req, "GET", s, "", &result, &found)
+	}
+	if !found && req.Method == "OPTIONS" {
+		var preflight []IStackable
+		traverseStackables(req, anyMethod, s, "", &preflight, &found)
+		found = false
+	}
+	return result, found
+}
+
+// anyMethod matches routes regardless of their method.
+const anyMethod = "*"
+
+func traverseStackables(req *Request, method string, stackable IStackable, parentPath string, result *[]IStackable, found *bool) {
 	if *found {
 		return
 	}
+	// Routes appended to a Stack by value match like registered ones.
+	if route, ok := stackable.(Route); ok {
+		stackable = &route
+	}
 	switch s := stackable.(type) {
-	case Route:
-		if s.Method != req.Method {
-			return
-		}
-
-		fullPath := strings.TrimSuffix(parentPath, "/") + "/" + strings.TrimPrefix(s.Path, "/")
-
-		routeParts := slices.DeleteFunc(strings.Split(fullPath, "/"), removeEmpty)
-		pathParts := slices.DeleteFunc(strings.Split(req.Path, "/"), removeEmpty)
-		if len(routeParts) != len(pathParts) {
+	case *Route:
+		if s.Method != method && method != anyMethod {
 			return
 		}
 
-		params := make(map[string]string)
-		match := true
-		for i, routePart := range routeParts {
-			pathPart := pathParts[i]
+		fullPath := joinPath(parentPath, s.Path)
 
-			if strings.HasPrefix(routePart, ":") {
-				paramName := routePart[1:]
-				params[paramName] = pathPart
-			} else {
-				if routePart != pathPart {
-					match = false
-					break
-				}
-			}
+		var params map[string]string
+		var match bool
+		if opts := req.server.PathOptions; opts != nil {
+			params, match = matchPathStrict(fullPath, routeHasTrailingSlash(s.Path), req.Path, opts)
+		} else {
+			params, match = matchPath(fullPath, req.Path)
 		}
 
 		if match {
@@ -244,10 +399,17 @@ func traverseStackables(req *Request, stackable IStackable, parentPath string, r
 
 	case *Router:
 		{
-			parentPath = strings.TrimSuffix(parentPath, "/") + "/" + strings.TrimPrefix(s.Path, "/")
+			parentPath = joinPath(parentPath, s.Path)
 
+			// Middlewares of a router only run when one of its routes matched.
+			start := len(*result)
 			for _, s := range stackable.GetStack() {
-				traverseStackables(req, s, parentPath, result, found)
+				traverseStackables(req, method, s, parentPath, result, found)
+			}
+			if *found {
+				req.routers = append(req.routers, s)
+			} else {
+				*result = (*result)[:start]
 			}
 		}
 	case Middleware:
@@ -257,11 +419,79 @@ func traverseStackables(req *Request, stackable IStackable, parentPath string, r
 	case *Server:
 		{
 			parentPath = strings.TrimSuffix(parentPath, "/") + "/"
+
+			if router, hostParams := s.matchHost(req); router != nil {
+				for _, m := range s.middlewares() {
+					*result = append(*result, m)
+				}
+				traverseStackables(req, method, router, parentPath, result, found)
+				if *found {
+					for k, v := range hostParams {
+						if _, ok := req.Params[k]; !ok {
+							req.Params[k] = v
+						}
+					}
+				}
+				return
+			}
+
 			for _, s := range stackable.GetStack() {
-				traverseStackables(req, s, parentPath, result, found)
+				traverseStackables(req, method, s, parentPath, result, found)
+			}
+		}
+	}
+}
+
+// matchPath matches a request path against a route pattern segment by
+// segment, ignoring empty segments, without splitting either string. A final
+// *name segment captures the rest of the path, which may be empty.
+func matchPath(pattern string, path string) (map[string]string, bool) {
+	var params map[string]string
+	for {
+		var routePart, pathPart string
+		routePart, pattern = nextSegment(pattern)
+
+		if strings.HasPrefix(routePart, "*") {
+			if params == nil {
+				params = make(map[string]string)
+			}
+			params[routePart[1:]] = strings.TrimLeft(path, "/")
+			return params, true
+		}
+
+		pathPart, path = nextSegment(path)
+
+		if routePart == "" || pathPart == "" {
+			if routePart != pathPart {
+				return nil, false
+			}
+			break
+		}
+
+		if strings.HasPrefix(routePart, ":") {
+			if params == nil {
+				params = make(map[string]string)
 			}
+			params[routePart[1:]] = pathPart
+		} else if routePart != pathPart {
+			return nil, false
 		}
 	}
+
+	if params == nil {
+		params = make(map[string]string)
+	}
+	return params, true
+}
+
+func nextSegment(path string) (string, string) {
+	for len(path) > 0 && path[0] == '/' {
+		path = path[1:]
+	}
+	if i := strings.IndexByte(path, '/'); i != -1 {
+		return path[:i], path[i:]
+	}
+	return path, ""
 }
 
 func (s *Server) SendEvent(identifier string, message string) {
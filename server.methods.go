@@ -1,46 +1,40 @@
 package gonanoweb
 
-func (s *Server) Get(path string, handler Handler, middlewares ...Middleware) {
-	validatePath(path)
-	for _, m := range middlewares {
-		s.Stack = append(s.Stack, m)
-	}
-
-	s.Stack = append(s.Stack, Route{Path: path, Handler: handler, Method: "GET"})
-}
+import "strings"
 
-func (s *Server) Post(path string, handler Handler, middlewares ...Middleware) {
+// Handle registers a handler for an arbitrary HTTP method. The middlewares
+// only run for this route, right before its handler.
+func (s *Server) Handle(method string, path string, handler Handler, middlewares ...Middleware) *Route {
 	validatePath(path)
-	for _, m := range middlewares {
-		s.Stack = append(s.Stack, m)
-	}
+	route := &Route{Path: path, Handler: handler, Method: strings.ToUpper(method), middlewares: middlewares}
+	s.Stack = append(s.Stack, route)
+	return route
+}
 
-	s.Stack = append(s.Stack, Route{Path: path, Handler: handler, Method: "POST"})
+func (s *Server) Get(path string, handler Handler, middlewares ...Middleware) *Route {
+	return s.Handle("GET", path, handler, middlewares...)
 }
 
-func (s *Server) Put(path string, handler Handler, middlewares ...Middleware) {
-	validatePath(path)
-	for _, m := range middlewares {
-		s.Stack = append(s.Stack, m)
-	}
+func (s *Server) Post(path string, handler Handler, middlewares ...Middleware) *Route {
+	return s.Handle("POST", path, handler, middlewares...)
+}
 
-	s.Stack = append(s.Stack, Route{Path: path, Handler: handler, Method: "PUT"})
+func (s *Server) Put(path string, handler Handler, middlewares ...Middleware) *Route {
+	return s.Handle("PUT", path, handler, middlewares...)
 }
 
-func (s *Server) Patch(path string, handler Handler, middlewares ...Middleware) {
-	validatePath(path)
-	for _, m := range middlewares {
-		s.Stack = append(s.Stack, m)
-	}
+func (s *Server) Patch(path string, handler Handler, middlewares ...Middleware) *Route {
+	return s.Handle("PATCH", path, handler, middlewares...)
+}
 
-	s.Stack = append(s.Stack, Route{Path: path, Handler: handler, Method: "PATCH"})
+func (s *Server) Delete(path string, handler Handler, middlewares ...Middleware) *Route {
+	return s.Handle("DELETE", path, handler, middlewares...)
 }
 
-func (s *Server) Delete(path string, handler Handler, middlewares ...Middleware) {
-	validatePath(path)
-	for _, m := range middlewares {
-		s.Stack = append(s.Stack, m)
-	}
+func (s *Server) Head(path string, handler Handler, middlewares ...Middleware) *Route {
+	return s.Handle("HEAD", path, handler, middlewares...)
+}
 
-	s.Stack = append(s.Stack, Route{Path: path, Handler: handler, Method: "DELETE"})
+func (s *Server) Options(path string, handler Handler, middlewares ...Middleware) *Route {
+	return s.Handle("OPTIONS", path, handler, middlewares...)
 }
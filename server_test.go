@@ -0,0 +1,199 @@
+package gonanoweb
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+// newUsersServer serves the small JSON API used to measure the cost of
+// handling a request.
+func newUsersServer() *Server {
+	s := NewServer(":0", nil)
+	s.Get("/users/:id", func(res *Response, req *Request) error {
+		res.Json(200, map[string]string{"id": req.Params["id"], "q": req.QueryParams["q"][0]})
+		return nil
+	})
+	s.Post("/users/:id", func(res *Response, req *Request) error {
+		res.Raw(200, *req.Body)
+		return nil
+	})
+	return s
+}
+
+func benchmarkHandleConnection(b *testing.B, raw string) {
+	s := newUsersServer()
+
+	request := []byte(raw)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		client, server := net.Pipe()
+		go s.handleConnection(server)
+		if _, err := client.Write(request); err != nil {
+			b.Fatal(err)
+		}
+		if _, err := io.Copy(io.Discard, client); err != nil {
+			b.Fatal(err)
+		}
+		client.Close()
+	}
+}
+
+func BenchmarkHandleConnection(b *testing.B) {
+	b.Run("GET with params", func(b *testing.B) {
+		benchmarkHandleConnection(b, "GET /users/42?q=search HTTP/1.1\r\n"+
+			"Host: example.com\r\n"+
+			"User-Agent: bench\r\n"+
+			"Accept: application/json\r\n\r\n")
+	})
+	b.Run("POST with body", func(b *testing.B) {
+		body := `{"name":"gopher","email":"gopher@example.com"}`
+		benchmarkHandleConnection(b, "POST /users/42 HTTP/1.1\r\n"+
+			"Host: example.com\r\n"+
+			"Content-Type: application/json\r\n"+
+			"Content-Length: 46\r\n\r\n"+body)
+	})
+}
+
+// testConn feeds a raw request to handleConnection and records what is
+// written back. Reads end with io.EOF once the request is consumed.
+type testConn struct {
+	reader  io.Reader
+	written bytes.Buffer
+}
+
+var testConnAddr = &net.TCPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 40000}
+
+func (c *testConn) Read(p []byte) (int, error)         { return c.reader.Read(p) }
+func (c *testConn) Write(p []byte) (int, error)        { return c.written.Write(p) }
+func (c *testConn) Close() error                       { return nil }
+func (c *testConn) LocalAddr() net.Addr                { return testConnAddr }
+func (c *testConn) RemoteAddr() net.Addr               { return testConnAddr }
+func (c *testConn) SetDeadline(t time.Time) error      { return nil }
+func (c *testConn) SetReadDeadline(t time.Time) error  { return nil }
+func (c *testConn) SetWriteDeadline(t time.Time) error { return nil }
+
+// serveRaw runs one raw HTTP request through the server and returns the
+// parsed response with its body read.
+func serveRaw(t *testing.T, s *Server, raw string) (*http.Response, string) {
+	t.Helper()
+	conn := &testConn{reader: strings.NewReader(raw)}
+	s.handleConnection(conn)
+
+	res, err := http.ReadResponse(bufio.NewReader(&conn.written), nil)
+	if err != nil {
+		t.Fatalf("reading response: %v (got %q)", err, conn.written.String())
+	}
+	body, _ := io.ReadAll(res.Body)
+	return res, string(body)
+}
+
+func TestRouteValueInStack(t *testing.T) {
+	s := NewServer(":0", nil)
+	s.Stack = append(s.Stack, Route{Path: "/value", Method: "GET", Handler: func(res *Response, req *Request) error {
+		res.Raw(200, []byte("ok"))
+		return nil
+	}})
+
+	res, body := serveRaw(t, s, "GET /value HTTP/1.1\r\nHost: example.com\r\n\r\n")
+	if res.StatusCode != 200 || body != "ok" {
+		t.Errorf("got %d %q, want 200 \"ok\"", res.StatusCode, body)
+	}
+	if routes := s.Routes(); len(routes) != 1 || routes[0].Path != "/value" {
+		t.Errorf("got routes %+v", routes)
+	}
+}
+
+func TestURLKeepsTrailingSlash(t *testing.T) {
+	s := NewServer(":0", &ServerOptions{PathOptions: &PathOptions{TrailingSlash: TrailingSlashStrict}})
+	handler := func(res *Response, req *Request) error {
+		res.Raw(200, []byte(req.Params["id"]))
+		return nil
+	}
+	s.Get("/users/:id/", handler).Name("user")
+	s.Get("/posts/:id", handler).Name("post")
+
+	tests := map[string]string{"user": "/users/42/", "post": "/posts/42"}
+	for name, want := range tests {
+		got, err := s.URL(name, map[string]string{"id": "42"}, nil)
+		if err != nil || got != want {
+			t.Errorf("URL(%q) = %q, %v; want %q", name, got, err, want)
+			continue
+		}
+		if res, _ := serveRaw(t, s, "GET "+got+" HTTP/1.1\r\nHost: example.com\r\n\r\n"); res.StatusCode != 200 {
+			t.Errorf("GET %s: got status %d", got, res.StatusCode)
+		}
+	}
+}
+
+func TestContentLength(t *testing.T) {
+	tests := []struct {
+		name       string
+		length     string
+		body       string
+		wantStatus int
+	}{
+		{name: "valid", length: "5", body: "hello", wantStatus: 200},
+		{name: "zero", length: "0", wantStatus: 200},
+		{name: "negative", length: "-1", body: "hello", wantStatus: 400},
+		{name: "not a number", length: "five", body: "hello", wantStatus: 400},
+		{name: "shorter body", length: "10", body: "hello", wantStatus: 400},
+	}
+
+	s := NewServer(":0", nil)
+	s.Post("/echo", func(res *Response, req *Request) error {
+		res.Raw(200, *req.Body)
+		return nil
+	})
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			res, body := serveRaw(t, s, "POST /echo HTTP/1.1\r\nHost: example.com\r\n"+
+				"Content-Length: "+tt.length+"\r\n\r\n"+tt.body)
+			if res.StatusCode != tt.wantStatus {
+				t.Errorf("got status %d (%s), want %d", res.StatusCode, body, tt.wantStatus)
+			}
+		})
+	}
+}
+
+func TestHandleConnectionAllocs(t *testing.T) {
+	if raceEnabled {
+		t.Skip("the race detector adds allocations")
+	}
+	s := newUsersServer()
+
+	// Bounds are the measured counts plus a small margin; raise them only
+	// for a deliberate change.
+	body := `{"name":"gopher","email":"gopher@example.com"}`
+	tests := []struct {
+		name string
+		raw  string
+		max  float64
+	}{
+		{name: "GET with params", raw: "GET /users/42?q=search HTTP/1.1\r\nHost: example.com\r\nUser-Agent: bench\r\nAccept: application/json\r\n\r\n", max: 30},
+		{name: "POST with body", raw: "POST /users/42 HTTP/1.1\r\nHost: example.com\r\nContent-Type: application/json\r\nContent-Length: 46\r\n\r\n" + body, max: 24},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			reader := strings.NewReader(tt.raw)
+			conn := &testConn{reader: reader}
+			allocs := testing.AllocsPerRun(100, func() {
+				reader.Reset(tt.raw)
+				conn.written.Reset()
+				s.handleConnection(conn)
+			})
+			if !strings.HasPrefix(conn.written.String(), "HTTP/1.1 200") {
+				t.Fatalf("got response %q", conn.written.String())
+			}
+			if allocs > tt.max {
+				t.Errorf("got %.0f allocations per request, want at most %.0f", allocs, tt.max)
+			}
+		})
+	}
+}
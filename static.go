@@ -0,0 +1,229 @@
+package gonanoweb
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"html"
+	"io"
+	"io/fs"
+	"mime"
+	"net/url"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+type StaticOptions struct {
+	Index         string // File served for directory requests
+	Browse        bool   // List directories that have no index file
+	Precompressed bool   // Serve "<file>.gz" to clients accepting gzip when it exists
+	SPA           bool   // Serve the root index file for missing paths without an extension
+	MaxAge        int    // Cache-Control max-age in seconds, 0 omits the header
+}
+
+func DefaultStaticOptions() StaticOptions {
+	return StaticOptions{
+		Index:         "index.html",
+		Browse:        false,
+		Precompressed: false,
+		SPA:           false,
+		MaxAge:        0,
+	}
+}
+
+// Static serves the files of fsys under prefix, e.g.
+// r.Static("/assets", os.DirFS("public"), nil) or, with go:embed,
+// r.Static("/", embeddedFS, &opts).
+func (r *Router) Static(prefix string, fsys fs.FS, options *StaticOptions) *Route {
+	return r.Get(joinPath(prefix, "*filepath"), staticHandler(fsys, options))
+}
+
+func (s *Server) Static(prefix string, fsys fs.FS, options *StaticOptions) *Route {
+	return s.Get(joinPath(prefix, "*filepath"), staticHandler(fsys, options))
+}
+
+func staticHandler(fsys fs.FS, options *StaticOptions) Handler {
+	if options == nil {
+		defaultOptions := DefaultStaticOptions()
+		options = &defaultOptions
+	}
+	if options.Index == "" {
+		options.Index = "index.html"
+	}
+	hashes := &sync.Map{}
+
+	return func(res *Response, req *Request) error {
+		requested := req.Params["filepath"]
+		dirRequest := strings.HasSuffix(req.Path, "/")
+
+		name := strings.TrimPrefix(path.Clean("/"+requested), "/")
+		if name == "" {
+			name = "."
+		}
+		if !fs.ValidPath(name) || strings.Contains(name, "\\") {
+			return ApiError{StatusCode: 404, Message: "File not found."}
+		}
+
+		info, err := fs.Stat(fsys, name)
+		if err != nil {
+			if options.SPA && errors.Is(err, fs.ErrNotExist) && path.Ext(name) == "" {
+				if info, err = fs.Stat(fsys, options.Index); err == nil && !info.IsDir() {
+					res.Headers.Set("Cache-Control", "no-cache")
+					return serveFSFile(res, req, fsys, options.Index, info, options, hashes)
+				}
+			}
+			return ApiError{StatusCode: 404, Message: "File not found."}.WithError(err)
+		}
+
+		if info.IsDir() {
+			if !dirRequest {
+				// Relative links in the index only resolve with a trailing slash.
+				location := req.Path + "/"
+				if req.rawQuery != "" {
+					location += "?" + req.rawQuery
+				}
+				res.Redirect(301, location)
+				return nil
+			}
+
+			index := path.Join(name, options.Index)
+			if indexInfo, err := fs.Stat(fsys, index); err == nil && !indexInfo.IsDir() {
+				return serveFSFile(res, req, fsys, index, indexInfo, options, hashes)
+			}
+			if options.Browse {
+				return listDirectory(res, req, fsys, name)
+			}
+			return ApiError{StatusCode: 404, Message: "File not found."}
+		}
+
+		return serveFSFile(res, req, fsys, name, info, options, hashes)
+	}
+}
+
+func serveFSFile(res *Response, req *Request, fsys fs.FS, name string, info fs.FileInfo, options *StaticOptions, hashes *sync.Map) error {
+	contentType := mime.TypeByExtension(path.Ext(name))
+	servedName, servedInfo := name, info
+
+	if options.Precompressed {
+		if gzInfo, err := fs.Stat(fsys, name+".gz"); err == nil && !gzInfo.IsDir() {
+			res.Headers.Add("Vary", "Accept-Encoding")
+			if acceptsEncoding(req.Headers["accept-encoding"], "gzip") {
+				servedName, servedInfo = name+".gz", gzInfo
+				res.Headers.Set("Content-Encoding", "gzip")
+			}
+		}
+	}
+
+	file, err := fsys.Open(servedName)
+	if err != nil {
+		return ApiError{StatusCode: 404, Message: "File not found."}.WithError(err)
+	}
+
+	// The file itself is handed to the response when possible so *os.File
+	// bodies can be sent with sendfile; it is closed after sending.
+	var content io.ReadSeeker
+	if seeker, ok := file.(io.ReadSeeker); ok {
+		content = seeker
+	} else {
+		// Not every fs.FS returns seekable files; fall back to memory.
+		data, err := io.ReadAll(file)
+		file.Close()
+		if err != nil {
+			return err
+		}
+		content = bytes.NewReader(data)
+	}
+
+	if contentType == "" {
+		contentType = detectContentType(name, content)
+	}
+	res.Headers.Set("Content-Type", contentType)
+
+	if options.MaxAge > 0 && res.Headers.Get("Cache-Control") == "" {
+		res.Headers.Set("Cache-Control", "public, max-age="+strconv.Itoa(options.MaxAge))
+	}
+
+	etag, err := fileETag(fsys, servedName, servedInfo, hashes)
+	if err != nil {
+		if closer, ok := content.(io.Closer); ok {
+			closer.Close()
+		}
+		return err
+	}
+
+	serveContent(res, req, content, servedInfo.Size(), etag, servedInfo.ModTime())
+	return nil
+}
+
+// fileETag derives an entity tag from the modification time and size, or
+// from a hash of the contents for file systems without modification times
+// such as embed.FS.
+func fileETag(fsys fs.FS, name string, info fs.FileInfo, hashes *sync.Map) (string, error) {
+	if !info.ModTime().IsZero() {
+		return "\"" + strconv.FormatInt(info.ModTime().UnixNano(), 36) + "-" + strconv.FormatInt(info.Size(), 36) + "\"", nil
+	}
+
+	if etag, ok := hashes.Load(name); ok {
+		return etag.(string), nil
+	}
+
+	file, err := fsys.Open(name)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	hash := sha256.New()
+	if _, err := io.Copy(hash, file); err != nil {
+		return "", err
+	}
+	etag := "\"" + hex.EncodeToString(hash.Sum(nil)[:16]) + "\""
+	hashes.Store(name, etag)
+	return etag, nil
+}
+
+func listDirectory(res *Response, req *Request, fsys fs.FS, name string) error {
+	entries, err := fs.ReadDir(fsys, name)
+	if err != nil {
+		return ApiError{StatusCode: 404, Message: "File not found."}.WithError(err)
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Name() < entries[j].Name() })
+
+	var b strings.Builder
+	title := html.EscapeString(req.Path)
+	b.WriteString("<!doctype html>\n<html><head><meta charset=\"utf-8\"><title>")
+	b.WriteString(title)
+	b.WriteString("</title></head><body><h1>")
+	b.WriteString(title)
+	b.WriteString("</h1><ul>\n")
+	if name != "." {
+		b.WriteString("<li><a href=\"../\">../</a></li>\n")
+	}
+	for _, entry := range entries {
+		display := entry.Name()
+		if entry.IsDir() {
+			display += "/"
+		}
+		b.WriteString("<li><a href=\"")
+		b.WriteString(html.EscapeString((&url.URL{Path: display}).EscapedPath()))
+		b.WriteString("\">")
+		b.WriteString(html.EscapeString(display))
+		b.WriteString("</a></li>\n")
+	}
+	b.WriteString("</ul></body></html>\n")
+
+	res.Status = 200
+	res.Headers.Set("Content-Type", "text/html; charset=utf-8")
+	res.Body = []byte(b.String())
+	return nil
+}
+
+// acceptsEncoding reports whether an Accept-Encoding header allows coding,
+// i.e. lists it (or "*") with a non-zero q-value.
+func acceptsEncoding(header string, coding string) bool {
+	return encodingQuality(header, strings.ToLower(coding)) > 0
+}
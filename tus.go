@@ -0,0 +1,590 @@
+package gonanoweb
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const tusVersion = "1.0.0"
+
+var (
+	ErrTusUploadNotFound  = errors.New("tus: upload not found")
+	ErrTusOffsetMismatch  = errors.New("tus: offset does not match the upload")
+	errTusInvalidUploadID = errors.New("tus: invalid upload id")
+)
+
+// TusUpload describes a resumable upload.
+type TusUpload struct {
+	ID        string
+	Size      int64
+	Offset    int64
+	Metadata  map[string]string
+	CreatedAt time.Time
+	UpdatedAt time.Time // Time of the last write
+}
+
+func (u TusUpload) Complete() bool {
+	return u.Offset == u.Size
+}
+
+// TusStore persists tus uploads. WriteChunk must reject writes whose offset
+// is not the current offset of the upload with ErrTusOffsetMismatch and keep
+// whatever was written before src failed.
+type TusStore interface {
+	NewUpload(upload TusUpload) (TusUpload, error)
+	GetUpload(id string) (TusUpload, error)
+	WriteChunk(id string, offset int64, src io.Reader) (int64, error)
+	Terminate(id string) error
+	ListUploads() ([]TusUpload, error)
+}
+
+type TusOptions struct {
+	MaxSize     int64                  // Largest upload accepted, sent as Tus-Max-Size; 0 means unlimited
+	Expiration  time.Duration          // Unfinished uploads are removed this long after their last write; 0 disables
+	CorsOptions *CorsOptions           // CORS settings for the tus routes, the tus headers are added to them
+	OnComplete  func(upload TusUpload) // Called once the last byte of an upload was written
+}
+
+func DefaultTusOptions() TusOptions {
+	return TusOptions{
+		MaxSize:    0,
+		Expiration: 24 * time.Hour,
+	}
+}
+
+// TusHandler implements the tus 1.0 resumable upload protocol with the
+// creation, creation-with-upload, termination and expiration extensions.
+// Mount its Router where uploads should live:
+//
+//	tus := gonanoweb.NewTusHandler(store, nil)
+//	defer tus.Stop()
+//	s.UseRouter("/files", tus.Router())
+//
+// PATCH bodies are streamed to the store; they are bounded by the
+// MaxRequestSize of the router or server, if set, and by MaxSize.
+type TusHandler struct {
+	store   TusStore
+	options TusOptions
+	cleanup *time.Ticker
+	done    chan struct{}
+	stop    sync.Once
+}
+
+func NewTusHandler(store TusStore, options *TusOptions) *TusHandler {
+	if options == nil {
+		defaultOptions := DefaultTusOptions()
+		options = &defaultOptions
+	}
+
+	h := &TusHandler{
+		store:   store,
+		options: *options,
+		done:    make(chan struct{}),
+	}
+
+	if h.options.Expiration > 0 {
+		h.cleanup = time.NewTicker(min(h.options.Expiration, time.Hour))
+		go h.cleanupLoop()
+	}
+	return h
+}
+
+// Stop ends the removal of expired uploads.
+func (h *TusHandler) Stop() {
+	h.stop.Do(func() {
+		if h.cleanup != nil {
+			h.cleanup.Stop()
+		}
+		close(h.done)
+	})
+}
+
+func (h *TusHandler) cleanupLoop() {
+	for {
+		select {
+		case <-h.cleanup.C:
+			h.removeExpired()
+		case <-h.done:
+			return
+		}
+	}
+}
+
+func (h *TusHandler) removeExpired() {
+	uploads, err := h.store.ListUploads()
+	if err != nil {
+		return
+	}
+	for _, upload := range uploads {
+		if h.expired(upload) {
+			h.store.Terminate(upload.ID)
+		}
+	}
+}
+
+func (h *TusHandler) expiresAt(upload TusUpload) time.Time {
+	if h.options.Expiration <= 0 || upload.Complete() {
+		return time.Time{}
+	}
+	return upload.UpdatedAt.Add(h.options.Expiration)
+}
+
+func (h *TusHandler) expired(upload TusUpload) bool {
+	expiresAt := h.expiresAt(upload)
+	return !expiresAt.IsZero() && time.Now().After(expiresAt)
+}
+
+// Router returns a router serving the upload collection at its root and the
+// uploads below it.
+func (h *TusHandler) Router() *Router {
+	router := NewRouter()
+	router.CorsOptions = tusCorsOptions(h.options.CorsOptions)
+	router.UseMiddleware(Middleware{Handler: h.middleware})
+
+	router.Options("/", h.discover)
+	router.Options("/:id", h.discover)
+	router.Post("/", h.create)
+	router.Head("/:id", h.head)
+	router.Patch("/:id", h.patch)
+	router.Delete("/:id", h.terminate)
+	return router
+}
+
+func tusCorsOptions(options *CorsOptions) *CorsOptions {
+	if options == nil {
+		return nil
+	}
+
+	merged := *options
+	merge := func(values []string, extra ...string) []string {
+		if len(values) > 0 && values[0] == "*" {
+			return values
+		}
+		result := append([]string{}, values...)
+		for _, value := range extra {
+			if !contains(result, value) {
+				result = append(result, value)
+			}
+		}
+		return result
+	}
+	merged.AllowedMethods = merge(options.AllowedMethods, "POST", "HEAD", "PATCH", "DELETE", "OPTIONS")
+	merged.AllowedHeaders = merge(options.AllowedHeaders, "Content-Type", "Tus-Resumable", "Upload-Length", "Upload-Metadata", "Upload-Offset")
+	merged.ExposedHeaders = merge(options.ExposedHeaders, "Location", "Tus-Resumable", "Tus-Version", "Tus-Extension", "Tus-Max-Size", "Upload-Offset", "Upload-Length", "Upload-Metadata", "Upload-Expires")
+	return &merged
+}
+
+func (h *TusHandler) middleware(res *Response, req *Request) error {
+	res.Headers.Set("Tus-Resumable", tusVersion)
+	if req.Method == "OPTIONS" {
+		return nil
+	}
+
+	if req.Headers["tus-resumable"] != tusVersion {
+		res.Headers.Set("Tus-Version", tusVersion)
+		return ApiError{StatusCode: 412, Message: "Unsupported tus version."}
+	}
+
+	// Chunks go straight from the connection into the store.
+	req.streamBody = true
+	return nil
+}
+
+func (h *TusHandler) discover(res *Response, req *Request) error {
+	res.Headers.Set("Tus-Version", tusVersion)
+	res.Headers.Set("Tus-Extension", "creation,creation-with-upload,termination,expiration")
+	if h.options.MaxSize > 0 {
+		res.Headers.Set("Tus-Max-Size", strconv.FormatInt(h.options.MaxSize, 10))
+	}
+	res.Status = 204
+	res.Body = nil
+	return nil
+}
+
+func (h *TusHandler) create(res *Response, req *Request) error {
+	if _, ok := req.Headers["upload-defer-length"]; ok {
+		return ApiError{StatusCode: 400, Message: "Upload-Defer-Length is not supported."}
+	}
+
+	size, err := strconv.ParseInt(req.Headers["upload-length"], 10, 64)
+	if err != nil || size < 0 {
+		return ApiError{StatusCode: 400, Message: "Invalid Upload-Length."}
+	}
+	if h.options.MaxSize > 0 && size > h.options.MaxSize {
+		return ApiError{StatusCode: 413, Message: "Upload too large."}.WithError(fmt.Errorf("upload length %d exceeds maximum %d", size, h.options.MaxSize))
+	}
+
+	metadata, err := parseTusMetadata(req.Headers["upload-metadata"])
+	if err != nil {
+		return ApiError{StatusCode: 400, Message: "Invalid Upload-Metadata."}.WithError(err)
+	}
+
+	upload, err := h.store.NewUpload(TusUpload{Size: size, Metadata: metadata})
+	if err != nil {
+		return err
+	}
+
+	res.Headers.Set("Location", joinPath(strings.TrimSuffix(req.Path, "/"), upload.ID))
+
+	if req.bodyStream != nil {
+		if err := h.checkChunk(req, upload); err != nil {
+			return err
+		}
+		if upload, err = h.writeChunk(req, upload); err != nil {
+			return err
+		}
+		res.Headers.Set("Upload-Offset", strconv.FormatInt(upload.Offset, 10))
+	}
+
+	h.setExpires(res, upload)
+	res.Status = 201
+	res.Body = nil
+	return nil
+}
+
+func (h *TusHandler) head(res *Response, req *Request) error {
+	upload, err := h.upload(req)
+	if err != nil {
+		return err
+	}
+
+	res.Headers.Set("Cache-Control", "no-store")
+	res.Headers.Set("Upload-Offset", strconv.FormatInt(upload.Offset, 10))
+	res.Headers.Set("Upload-Length", strconv.FormatInt(upload.Size, 10))
+	if len(upload.Metadata) > 0 {
+		res.Headers.Set("Upload-Metadata", formatTusMetadata(upload.Metadata))
+	}
+	h.setExpires(res, upload)
+	res.Status = 200
+	res.Body = nil
+	return nil
+}
+
+func (h *TusHandler) patch(res *Response, req *Request) error {
+	upload, err := h.upload(req)
+	if err != nil {
+		return err
+	}
+
+	offset, err := strconv.ParseInt(req.Headers["upload-offset"], 10, 64)
+	if err != nil || offset < 0 {
+		return ApiError{StatusCode: 400, Message: "Invalid Upload-Offset."}
+	}
+	if offset != upload.Offset {
+		return ApiError{StatusCode: 409, Message: "Upload-Offset does not match the upload."}
+	}
+	if err := h.checkChunk(req, upload); err != nil {
+		return err
+	}
+
+	if req.bodyStream != nil {
+		if upload, err = h.writeChunk(req, upload); err != nil {
+			return err
+		}
+	}
+
+	res.Headers.Set("Upload-Offset", strconv.FormatInt(upload.Offset, 10))
+	h.setExpires(res, upload)
+	res.Status = 204
+	res.Body = nil
+	return nil
+}
+
+func (h *TusHandler) terminate(res *Response, req *Request) error {
+	if _, err := h.upload(req); err != nil {
+		return err
+	}
+	if err := h.store.Terminate(req.Params["id"]); err != nil {
+		return err
+	}
+	res.Status = 204
+	res.Body = nil
+	return nil
+}
+
+// upload loads the upload named by the path, treating expired uploads as
+// gone.
+func (h *TusHandler) upload(req *Request) (TusUpload, error) {
+	upload, err := h.store.GetUpload(req.Params["id"])
+	if errors.Is(err, ErrTusUploadNotFound) || errors.Is(err, errTusInvalidUploadID) {
+		return upload, ApiError{StatusCode: 404, Message: "Upload not found."}.WithError(err)
+	}
+	if err != nil {
+		return upload, err
+	}
+
+	if h.expired(upload) {
+		h.store.Terminate(upload.ID)
+		return upload, ApiError{StatusCode: 410, Message: "Upload expired."}
+	}
+	return upload, nil
+}
+
+// checkChunk validates the Content-Type and length of a chunk before any of
+// it is read.
+func (h *TusHandler) checkChunk(req *Request, upload TusUpload) error {
+	mediaType, _, _ := mime.ParseMediaType(req.Headers["content-type"])
+	if mediaType != "application/offset+octet-stream" {
+		return ApiError{StatusCode: 415, Message: "Content-Type must be application/offset+octet-stream."}
+	}
+
+	length, _ := strconv.ParseInt(req.Headers["content-length"], 10, 64)
+	if length > upload.Size-upload.Offset {
+		return ApiError{StatusCode: 413, Message: "Chunk exceeds the upload length."}
+	}
+	return nil
+}
+
+func (h *TusHandler) writeChunk(req *Request, upload TusUpload) (TusUpload, error) {
+	offset, err := h.store.WriteChunk(upload.ID, upload.Offset, req.bodyStream)
+	if errors.Is(err, ErrTusOffsetMismatch) {
+		return upload, ApiError{StatusCode: 409, Message: "Upload-Offset does not match the upload."}.WithError(err)
+	}
+	if err != nil {
+		return upload, err
+	}
+
+	wasComplete := upload.Complete()
+	upload.Offset = offset
+	upload.UpdatedAt = time.Now()
+	if !wasComplete && upload.Complete() && h.options.OnComplete != nil {
+		h.options.OnComplete(upload)
+	}
+	return upload, nil
+}
+
+func (h *TusHandler) setExpires(res *Response, upload TusUpload) {
+	if expiresAt := h.expiresAt(upload); !expiresAt.IsZero() {
+		res.Headers.Set("Upload-Expires", expiresAt.UTC().Format(http.TimeFormat))
+	}
+}
+
+// parseTusMetadata decodes "key base64value,key2" Upload-Metadata headers.
+func parseTusMetadata(header string) (map[string]string, error) {
+	metadata := make(map[string]string)
+	for _, pair := range strings.Split(header, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+
+		key, encoded, _ := strings.Cut(pair, " ")
+		if key == "" {
+			return nil, errors.New("empty metadata key")
+		}
+		value, err := base64.StdEncoding.DecodeString(strings.TrimSpace(encoded))
+		if err != nil {
+			return nil, fmt.Errorf("metadata %q: %w", key, err)
+		}
+		metadata[key] = string(value)
+	}
+	return metadata, nil
+}
+
+func formatTusMetadata(metadata map[string]string) string {
+	keys := make([]string, 0, len(metadata))
+	for key := range metadata {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	pairs := make([]string, len(keys))
+	for i, key := range keys {
+		pairs[i] = key
+		if metadata[key] != "" {
+			pairs[i] += " " + base64.StdEncoding.EncodeToString([]byte(metadata[key]))
+		}
+	}
+	return strings.Join(pairs, ",")
+}
+
+// TusDiskStore keeps each upload as "<id>.bin" next to a "<id>.info" JSON
+// file in Dir. The offset of an upload is the size of its data file, so
+// partially written chunks survive a dropped connection or a restart.
+type TusDiskStore struct {
+	Dir   string
+	locks sync.Map
+}
+
+type tusInfo struct {
+	Size      int64             `json:"size"`
+	Metadata  map[string]string `json:"metadata,omitempty"`
+	CreatedAt time.Time         `json:"createdAt"`
+}
+
+func NewTusDiskStore(dir string) (*TusDiskStore, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	return &TusDiskStore{Dir: dir}, nil
+}
+
+func (s *TusDiskStore) paths(id string) (string, string, error) {
+	if len(id) != 32 {
+		return "", "", errTusInvalidUploadID
+	}
+	if _, err := hex.DecodeString(id); err != nil {
+		return "", "", errTusInvalidUploadID
+	}
+	base := filepath.Join(s.Dir, id)
+	return base + ".bin", base + ".info", nil
+}
+
+func (s *TusDiskStore) lock(id string) func() {
+	mu, _ := s.locks.LoadOrStore(id, &sync.Mutex{})
+	mu.(*sync.Mutex).Lock()
+	return mu.(*sync.Mutex).Unlock
+}
+
+func (s *TusDiskStore) NewUpload(upload TusUpload) (TusUpload, error) {
+	var id [16]byte
+	if _, err := rand.Read(id[:]); err != nil {
+		return upload, err
+	}
+	upload.ID = hex.EncodeToString(id[:])
+	upload.Offset = 0
+	upload.CreatedAt = time.Now()
+	upload.UpdatedAt = upload.CreatedAt
+
+	dataPath, infoPath, _ := s.paths(upload.ID)
+	info, err := json.Marshal(tusInfo{Size: upload.Size, Metadata: upload.Metadata, CreatedAt: upload.CreatedAt})
+	if err != nil {
+		return upload, err
+	}
+
+	data, err := os.OpenFile(dataPath, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o644)
+	if err != nil {
+		return upload, err
+	}
+	data.Close()
+	if err := os.WriteFile(infoPath, info, 0o644); err != nil {
+		os.Remove(dataPath)
+		return upload, err
+	}
+	return upload, nil
+}
+
+func (s *TusDiskStore) GetUpload(id string) (TusUpload, error) {
+	dataPath, infoPath, err := s.paths(id)
+	if err != nil {
+		return TusUpload{}, err
+	}
+
+	raw, err := os.ReadFile(infoPath)
+	if os.IsNotExist(err) {
+		return TusUpload{}, ErrTusUploadNotFound
+	}
+	if err != nil {
+		return TusUpload{}, err
+	}
+	var info tusInfo
+	if err := json.Unmarshal(raw, &info); err != nil {
+		return TusUpload{}, err
+	}
+
+	stat, err := os.Stat(dataPath)
+	if os.IsNotExist(err) {
+		return TusUpload{}, ErrTusUploadNotFound
+	}
+	if err != nil {
+		return TusUpload{}, err
+	}
+
+	return TusUpload{
+		ID:        id,
+		Size:      info.Size,
+		Offset:    stat.Size(),
+		Metadata:  info.Metadata,
+		CreatedAt: info.CreatedAt,
+		UpdatedAt: stat.ModTime(),
+	}, nil
+}
+
+func (s *TusDiskStore) WriteChunk(id string, offset int64, src io.Reader) (int64, error) {
+	unlock := s.lock(id)
+	defer unlock()
+
+	upload, err := s.GetUpload(id)
+	if err != nil {
+		return 0, err
+	}
+	if offset != upload.Offset {
+		return upload.Offset, ErrTusOffsetMismatch
+	}
+
+	dataPath, _, _ := s.paths(id)
+	data, err := os.OpenFile(dataPath, os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return offset, err
+	}
+
+	n, err := io.Copy(data, io.LimitReader(src, upload.Size-offset))
+	if closeErr := data.Close(); err == nil {
+		err = closeErr
+	}
+	return offset + n, err
+}
+
+func (s *TusDiskStore) Terminate(id string) error {
+	dataPath, infoPath, err := s.paths(id)
+	if err != nil {
+		return err
+	}
+
+	unlock := s.lock(id)
+	defer unlock()
+	defer s.locks.Delete(id)
+
+	infoErr := os.Remove(infoPath)
+	dataErr := os.Remove(dataPath)
+	if os.IsNotExist(infoErr) && os.IsNotExist(dataErr) {
+		return ErrTusUploadNotFound
+	}
+	if infoErr != nil && !os.IsNotExist(infoErr) {
+		return infoErr
+	}
+	if dataErr != nil && !os.IsNotExist(dataErr) {
+		return dataErr
+	}
+	return nil
+}
+
+func (s *TusDiskStore) ListUploads() ([]TusUpload, error) {
+	entries, err := os.ReadDir(s.Dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var uploads []TusUpload
+	for _, entry := range entries {
+		id, ok := strings.CutSuffix(entry.Name(), ".info")
+		if !ok {
+			continue
+		}
+		if upload, err := s.GetUpload(id); err == nil {
+			uploads = append(uploads, upload)
+		}
+	}
+	return uploads, nil
+}
+
+// Path returns the data file of a finished upload, e.g. to move it into
+// place from TusOptions.OnComplete.
+func (s *TusDiskStore) Path(id string) (string, error) {
+	dataPath, _, err := s.paths(id)
+	return dataPath, err
+}
@@ -0,0 +1,254 @@
+package gonanoweb
+
+import (
+	"errors"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func newTusTestServer(t *testing.T, options *TusOptions) (*Server, *TusDiskStore) {
+	t.Helper()
+	store, err := NewTusDiskStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	handler := NewTusHandler(store, options)
+	t.Cleanup(handler.Stop)
+
+	s := NewServer(":0", nil)
+	s.UseRouter("/files", handler.Router())
+	return s, store
+}
+
+func tusRequest(method string, path string, headers map[string]string, body string) string {
+	raw := method + " " + path + " HTTP/1.1\r\nHost: example.com\r\n"
+	for key, value := range headers {
+		raw += key + ": " + value + "\r\n"
+	}
+	if body != "" {
+		raw += "Content-Length: " + strconv.Itoa(len(body)) + "\r\n"
+	}
+	return raw + "\r\n" + body
+}
+
+func tusCreate(t *testing.T, s *Server, length int) string {
+	t.Helper()
+	res, _ := serveRaw(t, s, tusRequest("POST", "/files/", map[string]string{
+		"Tus-Resumable": "1.0.0",
+		"Upload-Length": strconv.Itoa(length),
+	}, ""))
+	if res.StatusCode != 201 {
+		t.Fatalf("create: got status %d", res.StatusCode)
+	}
+	return res.Header.Get("Location")
+}
+
+func TestTusPatch(t *testing.T) {
+	chunk := func(offset string) map[string]string {
+		return map[string]string{
+			"Tus-Resumable": "1.0.0",
+			"Content-Type":  "application/offset+octet-stream",
+			"Upload-Offset": offset,
+		}
+	}
+
+	tests := []struct {
+		name       string
+		headers    map[string]string
+		body       string
+		wantStatus int
+		wantOffset string // Upload-Offset reported by a following HEAD
+	}{
+		{name: "first chunk", headers: chunk("0"), body: "hello", wantStatus: 204, wantOffset: "5"},
+		{name: "whole upload", headers: chunk("0"), body: "helloworld", wantStatus: 204, wantOffset: "10"},
+		{name: "empty chunk", headers: chunk("0"), wantStatus: 204, wantOffset: "0"},
+		{name: "offset ahead", headers: chunk("5"), body: "world", wantStatus: 409, wantOffset: "0"},
+		{name: "negative offset", headers: chunk("-1"), body: "hello", wantStatus: 400, wantOffset: "0"},
+		{name: "malformed offset", headers: chunk("abc"), body: "hello", wantStatus: 400, wantOffset: "0"},
+		{name: "missing offset", headers: map[string]string{"Tus-Resumable": "1.0.0", "Content-Type": "application/offset+octet-stream"}, body: "hello", wantStatus: 400, wantOffset: "0"},
+		{name: "chunk past length", headers: chunk("0"), body: "helloworld!", wantStatus: 413, wantOffset: "0"},
+		{name: "wrong content type", headers: map[string]string{"Tus-Resumable": "1.0.0", "Content-Type": "application/octet-stream", "Upload-Offset": "0"}, body: "hello", wantStatus: 415, wantOffset: "0"},
+		{name: "missing tus version", headers: map[string]string{"Content-Type": "application/offset+octet-stream", "Upload-Offset": "0"}, body: "hello", wantStatus: 412, wantOffset: "0"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, _ := newTusTestServer(t, nil)
+			location := tusCreate(t, s, 10)
+
+			res, body := serveRaw(t, s, tusRequest("PATCH", location, tt.headers, tt.body))
+			if res.StatusCode != tt.wantStatus {
+				t.Fatalf("got status %d (%s), want %d", res.StatusCode, body, tt.wantStatus)
+			}
+
+			res, _ = serveRaw(t, s, tusRequest("HEAD", location, map[string]string{"Tus-Resumable": "1.0.0"}, ""))
+			if got := res.Header.Get("Upload-Offset"); got != tt.wantOffset {
+				t.Errorf("got offset %s, want %s", got, tt.wantOffset)
+			}
+			if got := res.Header.Get("Upload-Length"); got != "10" {
+				t.Errorf("got length %s, want 10", got)
+			}
+		})
+	}
+}
+
+func TestTusResumeAfterStaleOffset(t *testing.T) {
+	var completed []TusUpload
+	options := DefaultTusOptions()
+	options.OnComplete = func(upload TusUpload) { completed = append(completed, upload) }
+	s, store := newTusTestServer(t, &options)
+	location := tusCreate(t, s, 10)
+
+	patch := func(offset string, body string) int {
+		res, _ := serveRaw(t, s, tusRequest("PATCH", location, map[string]string{
+			"Tus-Resumable": "1.0.0",
+			"Content-Type":  "application/offset+octet-stream",
+			"Upload-Offset": offset,
+		}, body))
+		return res.StatusCode
+	}
+
+	if status := patch("0", "hello"); status != 204 {
+		t.Fatalf("first chunk: got %d", status)
+	}
+	if status := patch("0", "hello"); status != 409 {
+		t.Fatalf("resent chunk: got %d, want 409", status)
+	}
+	if status := patch("5", "world"); status != 204 {
+		t.Fatalf("second chunk: got %d", status)
+	}
+	if status := patch("10", "!"); status != 413 {
+		t.Fatalf("chunk after completion: got %d, want 413", status)
+	}
+
+	if len(completed) != 1 || completed[0].Offset != 10 {
+		t.Fatalf("OnComplete called with %+v", completed)
+	}
+	path, err := store.Path(completed[0].ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, _ := os.ReadFile(path)
+	if string(data) != "helloworld" {
+		t.Errorf("got data %q", data)
+	}
+}
+
+func TestTusShortChunkKeepsReceivedBytes(t *testing.T) {
+	s, _ := newTusTestServer(t, nil)
+	location := tusCreate(t, s, 10)
+
+	raw := tusRequest("PATCH", location, map[string]string{
+		"Tus-Resumable": "1.0.0",
+		"Content-Type":  "application/offset+octet-stream",
+		"Upload-Offset": "0",
+	}, "hello")
+	// The connection drops two bytes before the announced end of the body.
+	res, _ := serveRaw(t, s, raw[:len(raw)-2])
+	if res.StatusCode != 400 {
+		t.Fatalf("got status %d, want 400", res.StatusCode)
+	}
+
+	res, _ = serveRaw(t, s, tusRequest("HEAD", location, map[string]string{"Tus-Resumable": "1.0.0"}, ""))
+	if got := res.Header.Get("Upload-Offset"); got != "3" {
+		t.Errorf("got offset %s, want 3", got)
+	}
+}
+
+func TestTusCreate(t *testing.T) {
+	tests := []struct {
+		name       string
+		headers    map[string]string
+		wantStatus int
+	}{
+		{name: "valid", headers: map[string]string{"Upload-Length": "10"}, wantStatus: 201},
+		{name: "empty upload", headers: map[string]string{"Upload-Length": "0"}, wantStatus: 201},
+		{name: "at max size", headers: map[string]string{"Upload-Length": "100"}, wantStatus: 201},
+		{name: "over max size", headers: map[string]string{"Upload-Length": "101"}, wantStatus: 413},
+		{name: "negative length", headers: map[string]string{"Upload-Length": "-1"}, wantStatus: 400},
+		{name: "missing length", headers: map[string]string{}, wantStatus: 400},
+		{name: "deferred length", headers: map[string]string{"Upload-Defer-Length": "1"}, wantStatus: 400},
+		{name: "bad metadata", headers: map[string]string{"Upload-Length": "10", "Upload-Metadata": "name !!!"}, wantStatus: 400},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			options := DefaultTusOptions()
+			options.MaxSize = 100
+			s, _ := newTusTestServer(t, &options)
+
+			tt.headers["Tus-Resumable"] = "1.0.0"
+			res, body := serveRaw(t, s, tusRequest("POST", "/files/", tt.headers, ""))
+			if res.StatusCode != tt.wantStatus {
+				t.Errorf("got status %d (%s), want %d", res.StatusCode, body, tt.wantStatus)
+			}
+		})
+	}
+}
+
+func TestTusUnknownUpload(t *testing.T) {
+	s, _ := newTusTestServer(t, nil)
+	for _, id := range []string{"0123456789abcdef0123456789abcdef", "..%2F..%2Fetc"} {
+		res, _ := serveRaw(t, s, tusRequest("HEAD", "/files/"+id, map[string]string{"Tus-Resumable": "1.0.0"}, ""))
+		if res.StatusCode != 404 {
+			t.Errorf("%s: got status %d, want 404", id, res.StatusCode)
+		}
+	}
+}
+
+type failingReader struct {
+	data string
+}
+
+func (r *failingReader) Read(p []byte) (int, error) {
+	if r.data == "" {
+		return 0, errors.New("connection reset")
+	}
+	n := copy(p, r.data)
+	r.data = r.data[n:]
+	return n, nil
+}
+
+func TestTusDiskStoreWriteChunk(t *testing.T) {
+	store, err := NewTusDiskStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	upload, err := store.NewUpload(TusUpload{Size: 10})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := store.WriteChunk(upload.ID, 3, strings.NewReader("abc")); !errors.Is(err, ErrTusOffsetMismatch) {
+		t.Fatalf("write at wrong offset: got %v, want ErrTusOffsetMismatch", err)
+	}
+
+	offset, err := store.WriteChunk(upload.ID, 0, &failingReader{data: "abcd"})
+	if err == nil || offset != 4 {
+		t.Fatalf("interrupted write: got offset %d, err %v; want 4 and an error", offset, err)
+	}
+
+	offset, err = store.WriteChunk(upload.ID, 4, strings.NewReader("efghijklmnop"))
+	if err != nil || offset != 10 {
+		t.Fatalf("write past length: got offset %d, err %v; want 10", offset, err)
+	}
+
+	stored, err := store.GetUpload(upload.ID)
+	if err != nil || stored.Offset != 10 {
+		t.Fatalf("got %+v, %v", stored, err)
+	}
+	path, _ := store.Path(upload.ID)
+	file, _ := os.Open(path)
+	defer file.Close()
+	data, _ := io.ReadAll(file)
+	if string(data) != "abcdefghij" {
+		t.Errorf("got data %q", data)
+	}
+
+	if _, err := store.GetUpload("../" + upload.ID); err == nil {
+		t.Error("expected an error for an id with a path")
+	}
+}
@@ -0,0 +1,207 @@
+package gonanoweb
+
+import (
+	"crypto/md5"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// UploadStore receives file parts while the form is parsed, so uploads go
+// straight into storage without being buffered. Put returns where the file
+// was stored; it becomes FormFile.Location.
+type UploadStore interface {
+	Put(filename string, content io.Reader) (string, error)
+	Delete(location string) error
+}
+
+// LocalUploadStore writes uploads to files in Dir named after a random
+// prefix and the sanitized client file name.
+type LocalUploadStore struct {
+	Dir  string
+	Perm os.FileMode
+}
+
+func NewLocalUploadStore(dir string) (*LocalUploadStore, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	return &LocalUploadStore{Dir: dir, Perm: 0o644}, nil
+}
+
+func (s *LocalUploadStore) Put(filename string, content io.Reader) (string, error) {
+	var prefix [8]byte
+	if _, err := rand.Read(prefix[:]); err != nil {
+		return "", err
+	}
+	location := filepath.Join(s.Dir, hex.EncodeToString(prefix[:])+"-"+SanitizeFilename(filename))
+
+	perm := s.Perm
+	if perm == 0 {
+		perm = 0o644
+	}
+	file, err := os.OpenFile(location, os.O_WRONLY|os.O_CREATE|os.O_EXCL, perm)
+	if err != nil {
+		return "", err
+	}
+
+	_, err = io.Copy(file, content)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(location)
+		return "", err
+	}
+	return location, nil
+}
+
+func (s *LocalUploadStore) Delete(location string) error {
+	rel, err := filepath.Rel(s.Dir, location)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return fmt.Errorf("%q is outside the upload directory", location)
+	}
+	return os.Remove(location)
+}
+
+// SaveTo writes the file to path, replacing any existing file.
+func (f *FormFile) SaveTo(path string) error {
+	if f.Reader == nil {
+		return errors.New("file content is not available, it was written to an UploadStore")
+	}
+	if seeker, ok := f.Reader.(io.Seeker); ok {
+		if _, err := seeker.Seek(0, io.SeekStart); err != nil {
+			return err
+		}
+	}
+
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+
+	_, err = io.Copy(file, f.Reader)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(path)
+	}
+	return err
+}
+
+var windowsReservedNames = map[string]bool{
+	"CON": true, "PRN": true, "AUX": true, "NUL": true,
+	"COM1": true, "COM2": true, "COM3": true, "COM4": true, "COM5": true, "COM6": true, "COM7": true, "COM8": true, "COM9": true,
+	"LPT1": true, "LPT2": true, "LPT3": true, "LPT4": true, "LPT5": true, "LPT6": true, "LPT7": true, "LPT8": true, "LPT9": true,
+}
+
+// SanitizeFilename turns a client supplied file name into one that is safe
+// to create in a directory: path components, control and reserved
+// characters, leading dots and Windows device names are removed and the
+// result is at most 255 bytes, keeping the extension.
+func SanitizeFilename(name string) string {
+	if i := strings.LastIndexAny(name, `/\`); i != -1 {
+		name = name[i+1:]
+	}
+
+	name = strings.Map(func(c rune) rune {
+		switch {
+		case c == utf8.RuneError, unicode.IsControl(c), strings.ContainsRune(`<>:"|?*`, c):
+			return '_'
+		}
+		return c
+	}, name)
+	name = strings.TrimLeft(strings.TrimSpace(name), ".")
+	name = strings.TrimRight(name, ". ")
+
+	base, _, _ := strings.Cut(name, ".")
+	if windowsReservedNames[strings.ToUpper(base)] {
+		name = "_" + name
+	}
+
+	if len(name) > 255 {
+		ext := filepath.Ext(name)
+		if len(ext) > 32 {
+			ext = ""
+		}
+		name = truncateUTF8(name[:len(name)-len(ext)], 255-len(ext)) + ext
+	}
+
+	if name == "" {
+		return "file"
+	}
+	return name
+}
+
+func truncateUTF8(s string, n int) string {
+	for n > 0 && n < len(s) && !utf8.RuneStart(s[n]) {
+		n--
+	}
+	return s[:n]
+}
+
+type fileHashes map[string]hash.Hash
+
+// hashingReader returns content wrapped so that reading it feeds the
+// requested hashes.
+func hashingReader(content io.Reader, algorithms []string) (fileHashes, io.Reader, error) {
+	if len(algorithms) == 0 {
+		return nil, content, nil
+	}
+
+	hashes := make(fileHashes, len(algorithms))
+	writers := make([]io.Writer, 0, len(algorithms))
+	for _, algorithm := range algorithms {
+		algorithm = strings.ToLower(algorithm)
+		var h hash.Hash
+		switch algorithm {
+		case "sha256":
+			h = sha256.New()
+		case "sha512":
+			h = sha512.New()
+		case "sha1":
+			h = sha1.New()
+		case "md5":
+			h = md5.New()
+		default:
+			return nil, nil, fmt.Errorf("unsupported upload hash %q", algorithm)
+		}
+		hashes[algorithm] = h
+		writers = append(writers, h)
+	}
+	return hashes, io.TeeReader(content, io.MultiWriter(writers...)), nil
+}
+
+func (h fileHashes) sums() map[string]string {
+	if h == nil {
+		return nil
+	}
+	sums := make(map[string]string, len(h))
+	for algorithm, digest := range h {
+		sums[algorithm] = hex.EncodeToString(digest.Sum(nil))
+	}
+	return sums
+}
+
+type countingReader struct {
+	reader io.Reader
+	n      int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.reader.Read(p)
+	c.n += int64(n)
+	return n, err
+}
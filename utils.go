@@ -18,6 +18,11 @@ func validatePath(path string) {
 		log.Panic("path cannot contain path traversal sequences")
 	}
 
+	// A *wildcard segment captures the rest of the path, so it must be last
+	if i := strings.Index(path, "/*"); i != -1 && strings.Contains(path[i+1:], "/") {
+		log.Panic("wildcard segment must be the last segment of the path")
+	}
+
 	// Prevent control characters and null bytes in paths
 	for _, r := range path {
 		if r < 32 || r == 127 {
@@ -39,7 +44,3 @@ func currentDateString() string {
 	time := time.Now().UTC().Format(time.RFC1123)
 	return "Date: " + time[:len(time)-3] + "GMT"
 }
-
-func removeEmpty(v string) bool {
-	return v == ""
-}
@@ -0,0 +1,291 @@
+package gonanoweb
+
+import (
+	"fmt"
+	"net/mail"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"unicode/utf8"
+)
+
+// FieldError describes one failed validation rule. Field is the path of the
+// field as the client named it, e.g. "address.city" or "items[2].sku".
+type FieldError struct {
+	Field   string `json:"field"`
+	Rule    string `json:"rule"`
+	Param   string `json:"param,omitempty"`
+	Message string `json:"message"`
+}
+
+type ValidationErrors []FieldError
+
+func (e ValidationErrors) Error() string {
+	parts := make([]string, len(e))
+	for i, fieldErr := range e {
+		parts[i] = fieldErr.Field + " " + fieldErr.Message
+	}
+	return "validation failed: " + strings.Join(parts, "; ")
+}
+
+// ValidatorFunc reports whether value satisfies a custom rule; param is the
+// text after "=" in the tag, if any.
+type ValidatorFunc func(value reflect.Value, param string) bool
+
+var (
+	validatorsMu sync.RWMutex
+	validators   = map[string]ValidatorFunc{}
+	regexpCache  sync.Map
+)
+
+// RegisterValidator makes a custom rule usable in `validate` tags. Built-in
+// rules cannot be replaced.
+func RegisterValidator(name string, fn ValidatorFunc) {
+	switch name {
+	case "required", "omitempty", "min", "max", "len", "oneof", "email", "regexp":
+		panic("gonanoweb: cannot replace built-in validation rule " + name)
+	}
+
+	validatorsMu.Lock()
+	defer validatorsMu.Unlock()
+	validators[name] = fn
+}
+
+// Validate checks the `validate` tags of the struct v points to, e.g.
+// `validate:"required,min=3,max=64"`. Nested structs and slices of structs are
+// validated too. Failures are returned as a 422 ApiError whose Details are
+// the ValidationErrors; malformed tags are returned as plain errors.
+func Validate(v any) error {
+	value := reflect.ValueOf(v)
+	for value.Kind() == reflect.Pointer {
+		if value.IsNil() {
+			return fmt.Errorf("cannot validate nil %T", v)
+		}
+		value = value.Elem()
+	}
+	if value.Kind() != reflect.Struct {
+		return fmt.Errorf("cannot validate %T, expected a struct", v)
+	}
+
+	var errs ValidationErrors
+	if err := validateStruct(value, "", &errs); err != nil {
+		return err
+	}
+	if len(errs) > 0 {
+		return ApiError{StatusCode: 422, Message: "Validation failed.", Details: errs}.WithError(errs)
+	}
+	return nil
+}
+
+func validateStruct(v reflect.Value, prefix string, errs *ValidationErrors) error {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if !field.IsExported() {
+			continue
+		}
+
+		if field.Anonymous && field.Type.Kind() == reflect.Struct && field.Tag.Get("validate") == "" {
+			if err := validateStruct(v.Field(i), prefix, errs); err != nil {
+				return err
+			}
+			continue
+		}
+
+		name := prefix + fieldName(field)
+		if err := validateField(v.Field(i), field.Tag.Get("validate"), name, errs); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// fieldName is the name the client used for a field: its json tag, or any
+// binding tag, falling back to the Go name.
+func fieldName(field reflect.StructField) string {
+	for _, tag := range []string{"json", "xml", "form", "query", "param", "header"} {
+		if name, _, _ := strings.Cut(field.Tag.Get(tag), ","); name != "" && name != "-" {
+			return name
+		}
+	}
+	return field.Name
+}
+
+func validateField(v reflect.Value, tag string, name string, errs *ValidationErrors) error {
+	if tag != "-" {
+		for _, rule := range parseRules(tag) {
+			switch {
+			case rule.name == "omitempty":
+				if v.IsZero() {
+					return nil
+				}
+				continue
+			case rule.name == "required":
+				if v.IsZero() {
+					*errs = append(*errs, FieldError{Field: name, Rule: rule.name, Message: "is required"})
+					return nil
+				}
+				continue
+			case v.Kind() == reflect.Pointer && v.IsNil():
+				continue
+			}
+
+			message, err := checkRule(indirect(v), rule)
+			if err != nil {
+				return fmt.Errorf("field %s: %w", name, err)
+			}
+			if message != "" {
+				*errs = append(*errs, FieldError{Field: name, Rule: rule.name, Param: rule.param, Message: message})
+			}
+		}
+	}
+
+	v = indirect(v)
+	switch v.Kind() {
+	case reflect.Struct:
+		return validateStruct(v, name+".", errs)
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < v.Len(); i++ {
+			elem := indirect(v.Index(i))
+			if elem.Kind() == reflect.Struct {
+				if err := validateStruct(elem, name+"["+strconv.Itoa(i)+"].", errs); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
+
+func indirect(v reflect.Value) reflect.Value {
+	for v.Kind() == reflect.Pointer && !v.IsNil() {
+		v = v.Elem()
+	}
+	return v
+}
+
+type rule struct {
+	name  string
+	param string
+}
+
+// parseRules splits a validate tag on commas. A regexp rule takes the rest
+// of the tag so patterns may contain commas.
+func parseRules(tag string) []rule {
+	var rules []rule
+	for tag != "" {
+		var part string
+		if strings.HasPrefix(tag, "regexp=") {
+			part, tag = tag, ""
+		} else {
+			part, tag, _ = strings.Cut(tag, ",")
+		}
+
+		name, param, _ := strings.Cut(strings.TrimSpace(part), "=")
+		if name == "" {
+			continue
+		}
+		rules = append(rules, rule{name: name, param: param})
+	}
+	return rules
+}
+
+// checkRule returns a message describing why v breaks r, or "" if it does not.
+func checkRule(v reflect.Value, r rule) (string, error) {
+	switch r.name {
+	case "min", "max", "len":
+		limit, err := strconv.ParseFloat(r.param, 64)
+		if err != nil {
+			return "", fmt.Errorf("invalid %s parameter %q", r.name, r.param)
+		}
+		size, unit, ok := measure(v)
+		if !ok {
+			return "", fmt.Errorf("rule %s does not apply to %s", r.name, v.Type())
+		}
+		switch {
+		case r.name == "min" && size < limit:
+			return "must be at least " + r.param + unit, nil
+		case r.name == "max" && size > limit:
+			return "must be at most " + r.param + unit, nil
+		case r.name == "len" && size != limit:
+			return "must be exactly " + r.param + unit, nil
+		}
+		return "", nil
+
+	case "oneof":
+		options := strings.Fields(r.param)
+		actual := fmt.Sprint(v.Interface())
+		for _, option := range options {
+			if actual == option {
+				return "", nil
+			}
+		}
+		return "must be one of: " + strings.Join(options, ", "), nil
+
+	case "email":
+		if v.Kind() != reflect.String {
+			return "", fmt.Errorf("rule email does not apply to %s", v.Type())
+		}
+		address, err := mail.ParseAddress(v.String())
+		if err != nil || address.Address != v.String() {
+			return "must be a valid email address", nil
+		}
+		return "", nil
+
+	case "regexp":
+		if v.Kind() != reflect.String {
+			return "", fmt.Errorf("rule regexp does not apply to %s", v.Type())
+		}
+		re, err := compileCached(r.param)
+		if err != nil {
+			return "", err
+		}
+		if !re.MatchString(v.String()) {
+			return "must match the pattern " + r.param, nil
+		}
+		return "", nil
+	}
+
+	validatorsMu.RLock()
+	fn, ok := validators[r.name]
+	validatorsMu.RUnlock()
+	if !ok {
+		return "", fmt.Errorf("unknown validation rule %q", r.name)
+	}
+	if !fn(v, r.param) {
+		return "failed the " + r.name + " rule", nil
+	}
+	return "", nil
+}
+
+// measure returns what min, max and len compare: the length of strings
+// (in characters), slices and maps, or the value of numbers.
+func measure(v reflect.Value) (float64, string, bool) {
+	switch v.Kind() {
+	case reflect.String:
+		return float64(utf8.RuneCountInString(v.String())), " characters long", true
+	case reflect.Slice, reflect.Array, reflect.Map:
+		return float64(v.Len()), " items", true
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(v.Int()), "", true
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return float64(v.Uint()), "", true
+	case reflect.Float32, reflect.Float64:
+		return v.Float(), "", true
+	}
+	return 0, "", false
+}
+
+func compileCached(pattern string) (*regexp.Regexp, error) {
+	if re, ok := regexpCache.Load(pattern); ok {
+		return re.(*regexp.Regexp), nil
+	}
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, fmt.Errorf("invalid regexp %q: %w", pattern, err)
+	}
+	regexpCache.Store(pattern, re)
+	return re, nil
+}